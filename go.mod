@@ -1,5 +1,5 @@
 module github.com/sinloss/shipper
 
-go 1.13
+go 1.16
 
 require github.com/go-delve/delve v1.3.2 // indirect
@@ -1,26 +1,55 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/sinloss/shipper/shipper"
 )
 
 var (
-	t *string
-	p *string
-	v *string
+	t  *string
+	p  *string
+	v  *string
+	s  *bool
+	tb *bool
+	sh *int64
+	as *bool
+	ap *bool
+	ck *bool
+	ls bool
+	js *bool
+	le *bool
+	te *string
+	sa *bool
+	dv *bool
+	ns *string
 )
 
 func init() {
-	t = flag.String("t", "", "Specify the build tags for the generated go file")
+	t = flag.String("t", "", "Specify the build constraint for the generated go file, like \"linux && (amd64 || arm64)\" or the legacy \"linux,amd64 darwin\"")
 	p = flag.String("p", "main", "Specify the package name for the generated go file")
 	v = flag.String("v", "A", "Specify the variable name of map containing all the embeded files")
+	s = flag.Bool("s", false, "Ship the contents as string literals so that they are not copied at init")
+	tb = flag.Bool("table", false, "Ship a sorted lookup table instead of a map so that nothing is built at init")
+	sh = flag.Int64("shard", 0, "Shard the contents into go files named after the dest-file, each having at most the given bytes of contents")
+	as = flag.Bool("asm", false, "Ship the contents as go assembly in a .s file named after the dest-file")
+	ap = flag.Bool("append", false, "Append the contents to the dest-file executable, or ship the loader of them if the dest-file is a go file")
+	ck = flag.Bool("check", false, "Check if the dest-file is up to date without writing anything, exit non-zero if it is not")
+	flag.BoolVar(&ls, "n", false, "List how every file in dir would be shipped without writing anything")
+	flag.BoolVar(&ls, "list", false, "The same as -n")
+	js = flag.Bool("json", false, "List in the json format")
+	le = flag.Bool("lenient", false, "Leave out the files failing to be read with warnings instead of failing")
+	sa = flag.Bool("standalone", false, "Ship private copies of the shipper types so that the dest-file depends on nothing but the stdlib")
+	dv = flag.Bool("dev", false, "Read the included files in dir from the disk at run time in the development mode turned on by the shipper_dev build tag or the SHIPPER_DEV env")
+	ns = flag.String("ns", "", "Register the variable under the given namespace at init, to be found by shipper.Lookup and shipper.Open")
+	te = flag.String("template", "", "Specify a file of templates overriding the built-in ones of the same names")
 	flag.Usage = func() {
 		fmt.Printf("Usage: %s [options] <dir> <dest-file> [includes-without-gzip] [-- <includes-with-gzip>] \n",
 			filepath.Base(os.Args[0]))
@@ -41,7 +70,7 @@ func parse() (shipper.Meta, string) {
 		log.Fatalf("expecting at least 2 arguments yet got %d", l)
 	}
 
-	meta := shipper.Meta{Tags: *t, Package: *p, VarName: *v}
+	meta := shipper.Meta{Tags: *t, Package: *p, VarName: *v, Stringed: *s, Table: *tb, ShardSize: *sh, Asm: *as, Appended: *ap, Lenient: *le, Template: *te, Standalone: *sa, Dev: *dv, Namespace: *ns}
 	meta.Dir = positional[0]
 	destfile := positional[1]
 
@@ -87,9 +116,50 @@ func parse() (shipper.Meta, string) {
 	return meta, destfile
 }
 
+// list prints how every file would be shipped
+func list(meta shipper.Meta) error {
+	listings, err := shipper.List(meta)
+	if err != nil {
+		return err
+	}
+	if *js {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(listings)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tINCLUDE\tSIZE\tSHIPPED\tKEY")
+	for _, l := range listings {
+		switch {
+		case l.Include == "":
+			fmt.Fprintf(tw, "%s\t-\t%d\t-\t%s\n", l.Path, l.Size, l.Reason)
+		case l.Ref != "":
+			fmt.Fprintf(tw, "%s\t%s\t%d\t-\t%s (same as %s)\n", l.Path, l.Include, l.Size, l.Key, l.Ref)
+		case l.Gziped:
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d (gzip)\t%s\n", l.Path, l.Include, l.Size, l.Shipped, l.Key)
+		default:
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", l.Path, l.Include, l.Size, l.Shipped, l.Key)
+		}
+	}
+	return tw.Flush()
+}
+
 func main() {
 	meta, dest := parse()
-	err := shipper.Ship(meta, dest)
+	if ls {
+		if err := list(meta); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	ship := shipper.Ship
+	if *ck {
+		ship = shipper.Check
+	} else if meta.Appended && filepath.Ext(dest) != ".go" {
+		ship = shipper.Append
+	}
+	err := ship(meta, dest)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -11,14 +11,14 @@ var A = &shipper.Assets{
 
 	"hello": shipper.Content{
 		Gziped: false,
-		Bytes:  []byte("\x68\x0d\x0a"),
+		Bytes:  []byte("\x68\x0a"),
 	},
 	"world/bar.foo": shipper.Content{
 		Gziped: false,
-		Bytes:  []byte("\x62\x0d\x0a"),
+		Bytes:  []byte("\x62\x0a"),
 	},
 	"world/foo.bar": shipper.Content{
 		Gziped: true,
-		Bytes:  []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x4a\x53\xe0\xe5\x02\x04\x00\x00\xff\xff\x70\xa6\x3f\x52\x04\x00\x00\x00"),
+		Bytes:  []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x03\x00\xfc\xff\x66\x20\x0a\x03\x00\x3c\xa3\x4a\xc6\x03\x00\x00\x00"),
 	},
-}
\ No newline at end of file
+}
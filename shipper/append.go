@@ -0,0 +1,218 @@
+package shipper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// magic marks the end of an archive appended to an executable
+var magic = []byte("shipper\x01")
+
+// trailerSize is the size of the trailer ending an appended archive, which
+// consists of the index size, the archive size and the magic
+const trailerSize = 24
+
+// item indexes a file in the appended archive
+type item struct {
+	Name    string   `json:"name"`
+	Gziped  bool     `json:"gziped"`
+	Off     int64    `json:"off"` // relative to the start of the archive
+	Size    int64    `json:"size"`
+	Soname  string   `json:"soname,omitempty"`
+	Needed  []string `json:"needed,omitempty"`
+	Machine string   `json:"machine,omitempty"`
+	Class   string   `json:"class,omitempty"`
+	Order   string   `json:"order,omitempty"`
+}
+
+// appended finds the start of the archive appended to the given file and the
+// index of it, it returns -1 if there is none
+func appended(f io.ReaderAt, size int64) (int64, []item, error) {
+	if size < trailerSize {
+		return -1, nil, nil
+	}
+	trailer := make([]byte, trailerSize)
+	if _, err := f.ReadAt(trailer, size-trailerSize); err != nil {
+		return -1, nil, err
+	}
+	if !bytes.Equal(trailer[16:], magic) {
+		return -1, nil, nil
+	}
+	isize := int64(binary.LittleEndian.Uint64(trailer))
+	asize := int64(binary.LittleEndian.Uint64(trailer[8:]))
+	// the sizes are checked before anything is allocated by them
+	if isize < 0 || asize < trailerSize || asize > size || isize > asize-trailerSize {
+		return -1, nil, errors.New("corrupted archive")
+	}
+
+	start := size - asize
+	index := make([]byte, isize)
+	if _, err := f.ReadAt(index, size-trailerSize-isize); err != nil {
+		return -1, nil, err
+	}
+	var items []item
+	if err := json.Unmarshal(index, &items); err != nil {
+		return -1, nil, err
+	}
+	return start, items, nil
+}
+
+// Appended loads the assets from the archive appended to the running
+// executable. The contents are read lazily from the executable when restored
+func Appended() (*Assets, error) {
+	as := &Assets{}
+	exe, err := os.Executable()
+	if err != nil {
+		return as, err
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return as, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return as, err
+	}
+	start, items, err := appended(f, stat.Size())
+	if err == nil && start == -1 {
+		err = errors.New("no archive is appended to " + exe)
+	}
+	if err != nil {
+		f.Close()
+		return as, err
+	}
+	// the executable is kept open for reading the contents
+	for _, it := range items {
+		(*as)[it.Name] = Content{
+			Gziped:  it.Gziped,
+			Soname:  it.Soname,
+			Needed:  it.Needed,
+			Machine: it.Machine,
+			Class:   it.Class,
+			Order:   it.Order,
+			section: io.NewSectionReader(f, start+it.Off, it.Size)}
+	}
+	return as, nil
+}
+
+// counter counts the bytes written to the underlying writer
+type counter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *counter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	c.n += int64(n)
+	return
+}
+
+// Append appends the given set of files as an archive to an executable, which
+// replaces the previously appended one if there is any. The executable should
+// have been built with the assets shipped by the Appended meta
+func Append(meta Meta, exe string) error {
+	return NewBundle(meta).AddIncluded().Append(exe)
+}
+
+// Append appends the bundle as an archive to an executable, which replaces the
+// previously appended one if there is any. The new executable is written to a
+// temporary file first, which replaces the executable only if it is
+// successfully written
+func (b *Bundle) Append(exe string) (err error) {
+	if b.err != nil {
+		return b.err
+	}
+	// the executable is left untouched if the files could not be gathered
+	entries, err := b.gather()
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(exe)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	// strip the previously appended archive
+	start, _, err := appended(src, stat.Size())
+	if err != nil {
+		return err
+	}
+	if start == -1 {
+		start = stat.Size()
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(exe), "."+filepath.Base(exe)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), exe)
+		}
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	if err := f.Chmod(stat.Mode().Perm()); err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, io.NewSectionReader(src, 0, start)); err != nil {
+		return err
+	}
+
+	c := &counter{w: f}
+	var items []item
+	firsts := map[string]item{}
+	for _, e := range entries {
+		if e.Ref != "" {
+			// share the contents of the identical one
+			it := firsts[e.Ref]
+			it.Name = e.Filename
+			items = append(items, it)
+			continue
+		}
+		r, _, err := e.open()
+		if err != nil {
+			return err
+		}
+		off := c.n
+		err = pack(c, r, e.Gziped, nil)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		it := item{Name: e.Filename, Gziped: e.Gziped, Off: off, Size: c.n - off, Soname: e.Soname, Needed: e.Needed,
+			Machine: e.Machine, Class: e.Class, Order: e.Order}
+		items = append(items, it)
+		firsts[e.Filename] = it
+	}
+
+	index, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	if _, err := c.Write(index); err != nil {
+		return err
+	}
+	trailer := make([]byte, trailerSize)
+	binary.LittleEndian.PutUint64(trailer, uint64(len(index)))
+	binary.LittleEndian.PutUint64(trailer[8:], uint64(c.n+trailerSize))
+	copy(trailer[16:], magic)
+	_, err = c.Write(trailer)
+	return err
+}
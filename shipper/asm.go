@@ -0,0 +1,72 @@
+package shipper
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/sinloss/shipper/util"
+)
+
+// as writes the given bytes as the DATA directives of a symbol in go assembly,
+// which is far cheaper for the toolchain than a huge string literal
+type as struct {
+	f      io.Writer
+	symbol string
+	off    int64
+	buf    [8]byte // a DATA directive carries at most 8 bytes
+	n      int
+}
+
+func (a *as) Write(p []byte) (n int, err error) {
+	for _, b := range p {
+		a.buf[a.n] = b
+		a.n++
+		if a.n == len(a.buf) {
+			if err = a.flush(); err != nil {
+				return n, err
+			}
+		}
+		n++
+	}
+	return n, nil
+}
+
+// flush writes the buffered bytes as a DATA directive
+func (a *as) flush() error {
+	if a.n == 0 {
+		return nil
+	}
+	line := append([]byte("DATA ·"), a.symbol...)
+	line = append(line, '+')
+	line = strconv.AppendInt(line, a.off, 10)
+	line = append(line, "(SB)/"...)
+	line = strconv.AppendInt(line, int64(a.n), 10)
+	line = append(line, ", $\""...)
+	for _, b := range a.buf[:a.n] {
+		high, low := util.Hexchar(b)
+		line = append(line, '\\', 'x', high, low)
+	}
+	line = append(line, "\"\n"...)
+
+	a.off += int64(a.n)
+	a.n = 0
+	_, err := a.f.Write(line)
+	return err
+}
+
+// Close flushes the remaining bytes and declares the symbol as read-only data
+// of its total size. An empty symbol is left to the go side alone
+func (a *as) Close() error {
+	if err := a.flush(); err != nil {
+		return err
+	}
+	if a.off == 0 {
+		return nil
+	}
+	line := append([]byte("GLOBL ·"), a.symbol...)
+	line = append(line, "(SB), RODATA|NOPTR, $"...)
+	line = strconv.AppendInt(line, a.off, 10)
+	line = append(line, "\n\n"...)
+	_, err := a.f.Write(line)
+	return err
+}
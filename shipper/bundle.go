@@ -0,0 +1,508 @@
+package shipper
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"unicode"
+
+	"github.com/sinloss/shipper/wildcard"
+)
+
+// Options tells how a file added to a bundle is shipped
+type Options struct {
+	Gziped bool
+}
+
+// Bundle builds up a set of files from arbitrary sources to ship. The
+// errors occurred while adding files are reported when it is shipped
+type Bundle struct {
+	meta    Meta
+	entries []entry
+	err     error  // the invalidity failing the bundle whatsoever
+	errs    Errors // the files failing to be read
+}
+
+// NewBundle makes an empty bundle shipped by the given meta, the dir and the
+// includes of which are only used by AddIncluded
+func NewBundle(meta Meta) *Bundle {
+	return &Bundle{meta: meta}
+}
+
+// fail fails the bundle with the given error unless it has failed already
+func (b *Bundle) fail(err error) *Bundle {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+// AddFile adds the contents read from the given reader as a file of the given
+// name, the contents are read at once
+func (b *Bundle) AddFile(name string, r io.Reader, opts Options) *Bundle {
+	if name == "" {
+		return b.fail(errors.New("empty file name"))
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		b.errs = b.errs.add(fmt.Errorf("%s: %w", name, err))
+		return b
+	}
+	b.entries = append(b.entries, b.meta.entry(name, Include{Filename: name, Gziped: opts.Gziped},
+		func() (io.ReadCloser, int64, error) {
+			return ioutil.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+		}))
+	return b
+}
+
+// AddFS adds the files in the given file system matching any of the given
+// wildcard patterns, or all of them if there is no pattern. The files are
+// named after their paths in the file system
+func (b *Bundle) AddFS(fsys fs.FS, opts Options, patterns ...string) *Bundle {
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+	fas := make([]*wildcard.FA, len(patterns))
+	for i, pattern := range patterns {
+		fa, err := wildcard.Compile([]rune(pattern))
+		if err != nil {
+			return b.fail(err)
+		}
+		fas[i] = fa
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if name == "." {
+				return err
+			}
+			b.errs = b.errs.add(err)
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		for i, fa := range fas {
+			if fa.Search([]rune(name), true).AllMatching() {
+				b.entries = append(b.entries, b.meta.entry(name, Include{Filename: patterns[i], Gziped: opts.Gziped},
+					file(func() (fs.File, error) { return fsys.Open(name) })))
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return b.fail(err)
+	}
+	return b
+}
+
+// AddIncluded adds the files in the dir of the meta matching its includes
+func (b *Bundle) AddIncluded() *Bundle {
+	// check meta validity
+	if len(b.meta.Includes) == 0 {
+		return b.fail(errors.New("not a single file is included"))
+	}
+	// check dir validity
+	stat, err := os.Stat(b.meta.Dir)
+	if err != nil {
+		return b.fail(err)
+	}
+	if !stat.IsDir() {
+		return b.fail(errors.New("invalid directory"))
+	}
+
+	entries, err := collect(b.meta)
+	b.entries = append(b.entries, entries...)
+	b.errs = b.errs.add(err)
+	return b
+}
+
+// validate checks the validity of the bundle
+func (b *Bundle) validate() error {
+	if b.err != nil {
+		return b.err
+	}
+	if b.meta.Package == "" {
+		return errors.New("empty package")
+	}
+	if !token.IsIdentifier(b.meta.Package) || b.meta.Package == "_" {
+		return fmt.Errorf("the package %q is not a valid go identifier", b.meta.Package)
+	}
+	if b.meta.VarName == "" {
+		return errors.New("empty variable name")
+	}
+	// the variable is exported by capitalizing the first letter
+	runes := []rune(b.meta.VarName)
+	runes[0] = unicode.ToUpper(runes[0])
+	if !token.IsIdentifier(b.meta.VarName) || !token.IsExported(string(runes)) {
+		return fmt.Errorf("the variable name %q is not a go identifier starting with a letter", b.meta.VarName)
+	}
+	if b.meta.Tags != "" {
+		if _, err := constrain(b.meta.Tags); err != nil {
+			return err
+		}
+	}
+	if b.meta.Asm && b.meta.ShardSize > 0 {
+		return errors.New("the assembly needs no sharding")
+	}
+	if b.meta.Standalone && b.meta.Appended {
+		return errors.New("the appended assets could not be loaded standalone")
+	}
+	if b.meta.Standalone && b.meta.Dev {
+		return errors.New("the development mode needs the shipper package")
+	}
+	if b.meta.Namespace != "" {
+		if b.meta.Standalone {
+			return errors.New("the registry needs the shipper package")
+		}
+		if err := namespace(b.meta.Namespace); err != nil {
+			return err
+		}
+	}
+	if b.meta.Dev && len(b.meta.Includes) == 0 {
+		return errors.New("the development mode reads nothing but the included files")
+	}
+	return nil
+}
+
+// gather sorts the entries to ship and dedups them. The files failing to be
+// read fail the gathering unless in the lenient mode
+func (b *Bundle) gather() ([]entry, error) {
+	entries := append([]entry(nil), b.entries...)
+	ordering(entries)
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Filename == entries[i-1].Filename {
+			return nil, errors.New("duplicate file " + entries[i].Filename)
+		}
+	}
+
+	entries, err := dedup(entries)
+	errs := append(Errors{}, b.errs...).add(err)
+	for i := range entries {
+		if entries[i].Ref == "" {
+			errs = errs.add(inspect(&entries[i]))
+		}
+	}
+	if len(errs) == 0 {
+		return entries, nil
+	}
+	if !b.meta.Lenient {
+		return nil, errs
+	}
+	for _, err := range errs {
+		if b.meta.Warn != nil {
+			b.meta.Warn(err)
+		} else {
+			log.Printf("warning: %v", err)
+		}
+	}
+	return entries, nil
+}
+
+// nopCloser makes a writer a WriteCloser
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// WriteTo ships the bundle as a single go file to the given writer. The
+// sharding and the assembly need more than one file thus are not supported
+func (b *Bundle) WriteTo(w io.Writer) (int64, error) {
+	if err := b.validate(); err != nil {
+		return 0, err
+	}
+	if b.meta.ShardSize > 0 || b.meta.Asm {
+		return 0, errors.New("the sharding and the assembly need a destfile")
+	}
+	c := &counter{w: w}
+	err := b.ship("", func(string) (io.WriteCloser, error) {
+		return nopCloser{c}, nil
+	})
+	return c.n, err
+}
+
+// Ship ships the bundle to a destfile. The shipped files are written to
+// temporary files first, which replace the destfile and its shards and
+// assembly only if all of them are successfully shipped
+func (b *Bundle) Ship(destfile string) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+	if filepath.Ext(destfile) != ".go" {
+		return errors.New("destfile should be a go file")
+	}
+
+	// check dest file's directory
+	if err := ckdir(filepath.Dir(destfile)); err != nil {
+		return err
+	}
+	temps := map[string]string{}
+	err := b.ship(destfile, func(name string) (io.WriteCloser, error) {
+		f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+		if err != nil {
+			return nil, err
+		}
+		temps[name] = f.Name()
+		return f, f.Chmod(0644)
+	})
+
+	// the destfile is replaced last so that it never refers to the shards or
+	// the assembly missing, which are cleaned only if everything is replaced
+	names := make([]string, 0, len(temps))
+	for name := range temps {
+		if name != destfile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := temps[destfile]; ok {
+		names = append(names, destfile)
+	}
+	for _, name := range names {
+		if err == nil {
+			err = os.Rename(temps[name], name)
+		}
+		if err != nil {
+			os.Remove(temps[name])
+		}
+	}
+	if err == nil {
+		err = clean(destfile, temps)
+	}
+	return err
+}
+
+// formatted ships a go file formatted, which fails if the file does not
+// parse. Only the skeleton written by the templates is kept in memory, while
+// the contents of the entries are spooled to a temporary file and marked in
+// the skeleton, which are spliced back when the formatted skeleton is written
+type formatted struct {
+	skeleton bytes.Buffer
+	name     string
+	f        io.WriteCloser
+	marker   string
+	spool    *os.File
+	sizes    []int64 // the sizes of the spooled contents in order
+	spooling bool    // whether the contents are being spooled
+}
+
+// formatting makes the formatted go file written to the given file
+func formatting(name string, f io.WriteCloser) (*formatted, error) {
+	// the marker never shows up in any skeleton by chance
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &formatted{name: name, f: f, marker: "shipper" + hex.EncodeToString(nonce)}, nil
+}
+
+// Write writes the skeleton
+func (g *formatted) Write(p []byte) (int, error) {
+	g.spooling = false
+	return g.skeleton.Write(p)
+}
+
+// spooler spools the raw contents of the entries of the formatted go file
+type spooler formatted
+
+func (sp *spooler) Write(p []byte) (int, error) {
+	g := (*formatted)(sp)
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if g.spool == nil {
+		f, err := ioutil.TempFile("", "shipper-*.spool")
+		if err != nil {
+			return 0, err
+		}
+		g.spool = f
+	}
+	if !g.spooling {
+		g.skeleton.WriteString(g.marker)
+		g.sizes, g.spooling = append(g.sizes, 0), true
+	}
+	n, err := g.spool.Write(p)
+	g.sizes[len(g.sizes)-1] += int64(n)
+	return n, err
+}
+
+// contents returns the writer of the contents of the entries shipped to the
+// given go file, which are escaped as "\xNN"
+func contents(f io.Writer) io.Writer {
+	if g, ok := f.(*formatted); ok {
+		return (*spooler)(g)
+	}
+	return &w{f}
+}
+
+// splice writes the formatted skeleton with the spooled contents spliced back
+// in place of the markers
+func (g *formatted) splice() error {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, g.name, g.skeleton.Bytes(), parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("the shipped go file does not parse: %w", err)
+	}
+	var b bytes.Buffer
+	if err := format.Node(&b, fset, file); err != nil {
+		return err
+	}
+	if g.spool != nil {
+		if _, err := g.spool.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	out := bufio.NewWriter(g.f)
+	rest := b.Bytes()
+	for _, size := range g.sizes {
+		i := bytes.Index(rest, []byte(g.marker))
+		if i < 0 {
+			return errors.New("the contents are lost while formatting " + g.name)
+		}
+		if _, err := out.Write(rest[:i]); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(&w{out}, g.spool, size); err != nil {
+			return err
+		}
+		rest = rest[i+len(g.marker):]
+	}
+	if _, err := out.Write(rest); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+func (g *formatted) Close() error {
+	err := g.splice()
+	if cerr := g.f.Close(); err == nil {
+		err = cerr
+	}
+	if g.spool != nil {
+		g.spool.Close()
+		os.Remove(g.spool.Name())
+	}
+	return err
+}
+
+// relative returns the slash separated path of the target relative to the
+// base
+func relative(base string, target string) (string, error) {
+	base, err := filepath.Abs(base)
+	if err != nil {
+		return "", err
+	}
+	if target, err = filepath.Abs(target); err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(base, target)
+	return filepath.ToSlash(rel), err
+}
+
+// ship ships the bundle to the destfile along with its shards and assembly,
+// which are all created by the given create function. The go files are
+// checked and formatted before being written
+func (b *Bundle) ship(destfile string, create func(string) (io.WriteCloser, error)) (err error) {
+	meta := b.meta
+	if meta.Dev && destfile != "" {
+		// the dir is read relative to the shipped go file in the development
+		// mode
+		if meta.Dir, err = relative(filepath.Dir(destfile), meta.Dir); err != nil {
+			return err
+		}
+	}
+	tmpl, err := meta.templates()
+	if err != nil {
+		return err
+	}
+	next := create
+	create = func(name string) (io.WriteCloser, error) {
+		f, err := next(name)
+		if f == nil || filepath.Ext(name) == ".s" {
+			return f, err
+		}
+		g, ferr := formatting(name, f)
+		if ferr != nil {
+			f.Close()
+			return nil, ferr
+		}
+		return g, err
+	}
+	var entries []entry
+	if !meta.Appended {
+		// nothing is created if the files could not be gathered
+		if entries, err = b.gather(); err != nil {
+			return err
+		}
+	}
+
+	// create output file
+	dest, err := create(destfile)
+	s := &shipment{meta: meta, tmpl: tmpl, destfile: destfile, create: create, main: dest, dest: dest}
+	defer func() {
+		if cerr := s.close(); err == nil {
+			err = cerr
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	s.wo = contents(dest)
+
+	if meta.Appended {
+		// the contents are appended to the executable by Append
+		return s.tmpl.ExecuteTemplate(dest, "loader", meta)
+	}
+	if err := s.tmpl.ExecuteTemplate(dest, "fore", meta); err != nil {
+		return err
+	}
+	if meta.Asm {
+		f, err := create(asmname(destfile))
+		s.asmfile = f
+		if err != nil {
+			return err
+		}
+		s.asm = bufio.NewWriter(f)
+		if err := s.tmpl.ExecuteTemplate(s.asm, "asmFore", meta); err != nil {
+			return err
+		}
+	}
+	if meta.ShardSize > 0 {
+		// the destfile only declares the variable which the shards register to
+		if err := s.tmpl.ExecuteTemplate(dest, "aft", s.meta); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, 1048576)
+	for _, e := range entries {
+		if err := s.ship(e, buf); err != nil {
+			return err
+		}
+	}
+
+	if meta.ShardSize <= 0 || s.shard > 0 {
+		if err := s.tmpl.ExecuteTemplate(s.dest, "aft", s.meta); err != nil {
+			return err
+		}
+	}
+	return s.tmpl.ExecuteTemplate(s.dest, "decls", s.symbols)
+}
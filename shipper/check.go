@@ -0,0 +1,256 @@
+package shipper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Difference tells how the shipped files differ from the ones that should be
+// shipped
+type Difference struct {
+	Files   []string // the shipped files that are stale
+	Added   []string // names of the assets that should be added
+	Removed []string // names of the assets that should be removed
+	Changed []string // names of the assets that are changed
+}
+
+func (d *Difference) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s out of date: %d added, %d removed, %d changed",
+		strings.Join(d.Files, ", "), len(d.Added), len(d.Removed), len(d.Changed))
+	for _, suit := range []struct {
+		sign  string
+		names []string
+	}{{"+", d.Added}, {"-", d.Removed}, {"~", d.Changed}} {
+		for _, name := range suit.names {
+			fmt.Fprintf(&b, "\n  %s %s", suit.sign, name)
+		}
+	}
+	return b.String()
+}
+
+// memfile is a file shipped to the memory
+type memfile struct {
+	bytes.Buffer
+}
+
+func (m *memfile) Close() error {
+	return nil
+}
+
+// Check ships the given set of files to the memory and compares the result
+// with the destfile and its shards and assembly shipped before, nothing is
+// written. It returns a *Difference if they differ
+func Check(meta Meta, destfile string) error {
+	return NewBundle(meta).AddIncluded().Check(destfile)
+}
+
+// Check ships the bundle to the memory and compares the result with the
+// destfile and its shards and assembly shipped before, nothing is written.
+// It returns a *Difference if they differ
+func (b *Bundle) Check(destfile string) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+	if filepath.Ext(destfile) != ".go" {
+		return errors.New("destfile should be a go file")
+	}
+
+	fresh := map[string][]byte{}
+	files := map[string]*memfile{}
+	err := b.ship(destfile, func(name string) (io.WriteCloser, error) {
+		files[name] = &memfile{}
+		return files[name], nil
+	})
+	if err != nil {
+		return err
+	}
+	for name, f := range files {
+		fresh[name] = f.Bytes()
+	}
+
+	shipped := map[string][]byte{}
+	found, err := extras(destfile)
+	if err != nil {
+		return err
+	}
+	for _, name := range append(found, destfile) {
+		data, err := ioutil.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		shipped[name] = data
+	}
+
+	d := &Difference{}
+	for name, data := range fresh {
+		if old, ok := shipped[name]; !ok || !bytes.Equal(old, data) {
+			d.Files = append(d.Files, name)
+		}
+	}
+	for name := range shipped {
+		if _, ok := fresh[name]; !ok {
+			d.Files = append(d.Files, name)
+		}
+	}
+	if len(d.Files) == 0 {
+		return nil
+	}
+	sort.Strings(d.Files)
+
+	before, after := inventory(shipped), inventory(fresh)
+	for name, fp := range after {
+		if old, ok := before[name]; !ok {
+			d.Added = append(d.Added, name)
+		} else if old.gziped != fp.gziped || old.ref != fp.ref || !bytes.Equal(old.data, fp.data) {
+			d.Changed = append(d.Changed, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+	return d
+}
+
+// fingerprint carries what matters of a shipped asset
+type fingerprint struct {
+	gziped bool
+	ref    string
+	data   []byte // the chunks are joined
+}
+
+// inventory fingerprints every asset in the given shipped files
+func inventory(files map[string][]byte) map[string]fingerprint {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	// the chunks must be fingerprinted in order
+	sort.Strings(names)
+
+	symbols := map[string][]byte{}
+	for _, name := range names {
+		if filepath.Ext(name) != ".s" {
+			continue
+		}
+		for _, line := range strings.Split(string(files[name]), "\n") {
+			// DATA ·symbol+offset(SB)/width, $"data"
+			if !strings.HasPrefix(line, "DATA ·") {
+				continue
+			}
+			i, j := strings.IndexByte(line, '+'), strings.IndexByte(line, '$')
+			if i == -1 || j == -1 {
+				continue
+			}
+			if data, err := strconv.Unquote(line[j+1:]); err == nil {
+				symbol := line[len("DATA ·"):i]
+				symbols[symbol] = append(symbols[symbol], data...)
+			}
+		}
+	}
+
+	assets := map[string]fingerprint{}
+	fset := token.NewFileSet()
+	for _, name := range names {
+		if filepath.Ext(name) != ".go" {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, files[name], 0)
+		if err != nil {
+			continue
+		}
+		// stamp fingerprints the contents into the asset of the given key
+		stamp := func(key ast.Expr, contents ast.Expr) bool {
+			lit, ok := key.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return false
+			}
+			name, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				return false
+			}
+			fp := assets[name]
+			ast.Inspect(contents, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.KeyValueExpr:
+					ident, _ := n.Key.(*ast.Ident)
+					value, _ := n.Value.(*ast.Ident)
+					lit, _ := n.Value.(*ast.BasicLit)
+					if ident != nil && ident.Name == "Gziped" && value != nil {
+						fp.gziped = value.Name == "true"
+					} else if ident != nil && ident.Name == "Ref" && lit != nil {
+						fp.ref, _ = strconv.Unquote(lit.Value)
+						return false
+					} else if ident != nil && (ident.Name == "Soname" || ident.Name == "Needed" ||
+						ident.Name == "Machine" || ident.Name == "Class" || ident.Name == "Order") {
+						// derived from the data
+						return false
+					}
+				case *ast.BasicLit:
+					if data, err := strconv.Unquote(n.Value); err == nil && n.Kind == token.STRING {
+						fp.data = append(fp.data, data...)
+					}
+				case *ast.SliceExpr:
+					// the symbol defined in assembly
+					if ident, ok := n.X.(*ast.Ident); ok {
+						fp.data = append(fp.data, symbols[ident.Name]...)
+					}
+				}
+				return true
+			})
+			assets[name] = fp
+			return true
+		}
+
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.KeyValueExpr:
+				// an entry of the assets
+				return !stamp(n.Key, n.Value)
+			case *ast.CompositeLit:
+				// an entry of the table
+				var key, content ast.Expr
+				for _, elt := range n.Elts {
+					kv, ok := elt.(*ast.KeyValueExpr)
+					if !ok {
+						continue
+					}
+					if ident, ok := kv.Key.(*ast.Ident); ok && ident.Name == "Name" {
+						key = kv.Value
+					} else if ok && ident.Name == "Content" {
+						content = kv.Value
+					}
+				}
+				if key != nil && content != nil {
+					return !stamp(key, content)
+				}
+			case *ast.CallExpr:
+				// an entry or a chunk put by the shards
+				sel, ok := n.Fun.(*ast.SelectorExpr)
+				if ok && (sel.Sel.Name == "Put" || sel.Sel.Name == "PutChunk") && len(n.Args) >= 2 {
+					return !stamp(n.Args[0], n.Args[len(n.Args)-1])
+				}
+			}
+			return true
+		})
+	}
+	return assets
+}
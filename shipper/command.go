@@ -0,0 +1,69 @@
+package shipper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+)
+
+// extract extracts the executable of the given name in the cargo to the user
+// cache directory, named after the digest of its contents so that an
+// unchanged one is extracted only once. It returns the path of the executable
+func extract(c Cargo, name string) (string, error) {
+	content, ok := c.Get(name)
+	if !ok {
+		return "", errors.New("could not find contents mapped to the given filename " + name)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, content.raw()); err != nil {
+		return "", err
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cache, "shipper", hex.EncodeToString(h.Sum(nil))[:32])
+	exe := filepath.Join(dir, path.Base(name))
+	if stat, err := os.Stat(exe); err == nil && stat.Mode()&0100 != 0 {
+		return exe, nil
+	}
+
+	// an interrupted extraction is never taken for a complete one
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, "."+path.Base(name)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	tmp := f.Name()
+	f.Close()
+	err = c.RestoreAs(name, tmp)
+	if err == nil {
+		err = os.Chmod(tmp, 0755)
+	}
+	if err == nil {
+		err = os.Rename(tmp, exe)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return exe, nil
+}
+
+// Command returns the command running the shipped executable of the given name
+// in the cargo with the given arguments. The executable is extracted to the
+// user cache directory, unless the same one has been extracted before
+func Command(c Cargo, name string, args ...string) (*exec.Cmd, error) {
+	exe, err := extract(c, name)
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(exe, args...), nil
+}
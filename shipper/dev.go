@@ -0,0 +1,110 @@
+package shipper
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DevEnv is the environment variable turning on the development mode when set
+// to a true value like 1, which is also turned on by the shipper_dev build tag
+const DevEnv = "SHIPPER_DEV"
+
+// devs maps the cargoes in the development mode to the dirs they read from
+var devs = struct {
+	sync.RWMutex
+	cargoes map[Cargo]*dev
+}{cargoes: map[Cargo]*dev{}}
+
+// dev reads the contents from the dir they are shipped from
+type dev struct {
+	meta Meta
+}
+
+// Developing tells whether the development mode is on
+func Developing() bool {
+	on, _ := strconv.ParseBool(os.Getenv(DevEnv))
+	return on || devTag
+}
+
+// Develop makes the given cargo read the files in the given dir matching any
+// of the given includes in the development mode, so that the edits show up
+// without shipping again. A relative dir is relative to the directory of the
+// calling go file, which is unknown to the builds with -trimpath thus fails.
+// It is called by the shipped go files at init, and does nothing if the
+// development mode is off
+func Develop(c Cargo, dir string, includes ...string) error {
+	if !Developing() {
+		return nil
+	}
+	dir = filepath.FromSlash(dir)
+	if !filepath.IsAbs(dir) {
+		_, file, _, ok := runtime.Caller(1)
+		if !ok || !filepath.IsAbs(file) {
+			return errors.New("the development mode could not find " + dir +
+				" relative to the shipped go file " + file + ", which needs a build without -trimpath")
+		}
+		dir = filepath.Join(filepath.Dir(file), dir)
+	}
+	if stat, err := os.Stat(dir); err != nil {
+		return err
+	} else if !stat.IsDir() {
+		return errors.New("the development mode reads from " + dir + " which is not a directory")
+	}
+	meta := Meta{Dir: dir}
+	for _, include := range includes {
+		if err := meta.Including(include, false); err != nil {
+			return err
+		}
+	}
+	devs.Lock()
+	defer devs.Unlock()
+	devs.cargoes[c] = &dev{meta: meta}
+	return nil
+}
+
+// developing finds the dev of the given cargo, which is nil if the cargo is
+// not in the development mode
+func developing(c Cargo) *dev {
+	devs.RLock()
+	defer devs.RUnlock()
+	return devs.cargoes[c]
+}
+
+// Get reads the file of the given name if it is included
+func (d *dev) Get(name string) (Content, bool) {
+	// never read the files out of the dir
+	if name == "" || path.Clean(name) != name || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return Content{}, false
+	}
+	fullpath := filepath.Join(d.meta.Dir, filepath.FromSlash(name))
+	include, ok := d.meta.match(fullpath)
+	if !ok {
+		return Content{}, false
+	}
+	data, err := ioutil.ReadFile(fullpath)
+	if err != nil {
+		return Content{}, false
+	}
+	e := d.meta.entry(name, include, file(func() (fs.File, error) { return os.Open(fullpath) }))
+	inspect(&e)
+	return Content{Bytes: data, Soname: e.Soname, Needed: e.Needed, Machine: e.Machine, Class: e.Class,
+		Order: e.Order, live: true}, true
+}
+
+// Names returns the sorted names of the included files
+func (d *dev) Names() []string {
+	entries, _ := collect(d.meta)
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Filename
+	}
+	return names
+}
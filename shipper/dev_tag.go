@@ -0,0 +1,7 @@
+//go:build shipper_dev
+// +build shipper_dev
+
+package shipper
+
+// devTag turns on the development mode by the shipper_dev build tag
+const devTag = true
@@ -0,0 +1,190 @@
+package shipper
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// machines maps the architectures to the ELF machines, classes and byte
+// orders they run
+var machines = map[string][3]string{
+	"386":      {"EM_386", "ELFCLASS32", "ELFDATA2LSB"},
+	"amd64":    {"EM_X86_64", "ELFCLASS64", "ELFDATA2LSB"},
+	"arm":      {"EM_ARM", "ELFCLASS32", "ELFDATA2LSB"},
+	"arm64":    {"EM_AARCH64", "ELFCLASS64", "ELFDATA2LSB"},
+	"loong64":  {"EM_LOONGARCH", "ELFCLASS64", "ELFDATA2LSB"},
+	"mips":     {"EM_MIPS", "ELFCLASS32", "ELFDATA2MSB"},
+	"mipsle":   {"EM_MIPS", "ELFCLASS32", "ELFDATA2LSB"},
+	"mips64":   {"EM_MIPS", "ELFCLASS64", "ELFDATA2MSB"},
+	"mips64le": {"EM_MIPS", "ELFCLASS64", "ELFDATA2LSB"},
+	"ppc64":    {"EM_PPC64", "ELFCLASS64", "ELFDATA2MSB"},
+	"ppc64le":  {"EM_PPC64", "ELFCLASS64", "ELFDATA2LSB"},
+	"riscv64":  {"EM_RISCV", "ELFCLASS64", "ELFDATA2LSB"},
+	"s390x":    {"EM_S390", "ELFCLASS64", "ELFDATA2MSB"},
+}
+
+// inspect records the machine, the class and the byte order of the ELF file of the given
+// entry, along with the SONAME and the DT_NEEDED entries if it is a shared
+// library. Nothing is recorded if it is not an ELF file
+func inspect(e *entry) error {
+	f, _, err := e.open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	head := make([]byte, len(elf.ELFMAG))
+	if _, err := io.ReadFull(f, head); err != nil || string(head) != elf.ELFMAG {
+		// the linker scripts named after the libraries are shipped as they are
+		return nil
+	}
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		rest, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		ra = bytes.NewReader(append(head, rest...))
+	}
+
+	ef, err := elf.NewFile(ra)
+	if err != nil {
+		// merely looking like an ELF file
+		return nil
+	}
+	defer ef.Close()
+	e.Machine, e.Class, e.Order = ef.Machine.String(), ef.Class.String(), ef.Data.String()
+	if ef.Type != elf.ET_DYN || ef.Section(".dynamic") == nil {
+		return nil
+	}
+	sonames, err := ef.DynString(elf.DT_SONAME)
+	if err != nil {
+		return fmt.Errorf("%s: %w", e.Filename, err)
+	}
+	if len(sonames) > 0 {
+		e.Soname = sonames[0]
+	}
+	if e.Needed, err = ef.DynString(elf.DT_NEEDED); err != nil {
+		return fmt.Errorf("%s: %w", e.Filename, err)
+	}
+	return nil
+}
+
+// runnable checks if the ELF file of the given content runs on the running
+// architecture, the others are always runnable
+func runnable(name string, content Content) error {
+	want, ok := machines[runtime.GOARCH]
+	if content.Machine == "" || !ok ||
+		(content.Machine == want[0] && content.Class == want[1] && (content.Order == "" || content.Order == want[2])) {
+		return nil
+	}
+	return fmt.Errorf("%s is built for %s %s %s which does not run on %s",
+		name, content.Machine, content.Class, content.Order, runtime.GOARCH)
+}
+
+// anyArch is the view of a cargo restoring the ELF files built for any
+// architecture
+type anyArch struct {
+	Cargo
+}
+
+// Get returns the content of the given name without the architecture, which
+// is thus never checked
+func (a anyArch) Get(name string) (Content, bool) {
+	content, ok := a.Cargo.Get(name)
+	content.Machine, content.Class, content.Order = "", "", ""
+	return content, ok
+}
+
+func (a anyArch) Restore(names ...string) error {
+	return restore(a, names...)
+}
+
+func (a anyArch) RestoreAs(name string, dest string) error {
+	return restoreAs(a, name, dest)
+}
+
+// RestoreAnyArch restores the given contents of the cargo like Restore,
+// except that the ELF files built for other architectures are restored as
+// well, such as the ones to be deployed elsewhere
+func RestoreAnyArch(c Cargo, names ...string) error {
+	return restore(anyArch{c}, names...)
+}
+
+// RestoreAsAnyArch restores the content of the given name in the cargo to the
+// given dest path like RestoreAs, except that the ELF file built for another
+// architecture is restored as well
+func RestoreAsAnyArch(c Cargo, name string, dest string) error {
+	return restoreAs(anyArch{c}, name, dest)
+}
+
+// ordered orders the given names so that the shared libraries come after the
+// ones they need, the others are left in order
+func ordered(c Cargo, names []string) []string {
+	sonames := map[string]string{}
+	for _, name := range names {
+		if content, ok := c.Get(name); ok && content.Soname != "" {
+			sonames[content.Soname] = name
+		}
+	}
+	if len(sonames) == 0 {
+		return names
+	}
+
+	var order []string
+	visited := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		if content, ok := c.Get(name); ok {
+			for _, needed := range content.Needed {
+				if dep, ok := sonames[needed]; ok {
+					visit(dep)
+				}
+			}
+		}
+		order = append(order, name)
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return order
+}
+
+// link links the SONAME of the shared library restored to the dest path to
+// it, so does the linker name without the version to the SONAME. The
+// existing files are never replaced except for the links
+func link(dest string, soname string) error {
+	dir, base := filepath.Dir(dest), filepath.Base(dest)
+	links := [][2]string{{soname, base}}
+	if i := strings.Index(soname, ".so."); i != -1 {
+		links = append(links, [2]string{soname[:i+len(".so")], soname})
+	}
+	for _, l := range links {
+		name, target := filepath.Join(dir, l[0]), l[1]
+		if l[0] == target || l[0] == base {
+			continue
+		}
+		if stat, err := os.Lstat(name); err == nil {
+			if stat.Mode()&os.ModeSymlink == 0 {
+				continue
+			}
+			if err := os.Remove(name); err != nil {
+				return err
+			}
+		}
+		if err := os.Symlink(target, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
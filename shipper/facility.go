@@ -1,42 +1,182 @@
 package shipper
 
 import (
+	"bytes"
+	"compress/gzip"
 	"errors"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 )
 
 // Content represents the file's content
 type Content struct {
 	Gziped bool
-	Bytes  []byte
+	// Bytes carries the content shipped as a []byte literal or defined in
+	// assembly, the latter lies in read-only memory thus faults if written
+	Bytes []byte
+	// Str carries the content when it is shipped as a string literal, which
+	// stays in the read-only data of the binary instead of getting copied to
+	// the heap at init
+	Str string
+	// Chunks carries the content split across several shipped files, which
+	// are read one after another
+	Chunks []Content
+	// Ref is the name of another content which is identical with this one and
+	// is shipped in place of it
+	Ref string
+	// Soname and Needed are the SONAME and the DT_NEEDED entries of an ELF
+	// shared library, the SONAME is linked to it when restored
+	Soname string
+	Needed []string
+	// Machine, Class and Order are the machine, the class and the byte order
+	// of an ELF file, which fails to be restored if it does not run on the
+	// running architecture
+	Machine string
+	Class   string
+	Order   string
+	// section is where the content lies in a file read lazily
+	section *io.SectionReader
+	// live tells that the content is read from the disk in the development
+	// mode, which might change thus is never cached
+	live bool
+}
+
+// Cargo is anything carrying the shipped contents
+type Cargo interface {
+	Get(name string) (Content, bool)
+	Names() []string
+	Restore(names ...string) error
+	RestoreAs(name string, dest string) error
 }
 
 // Assets maps a file's name to its content
 type Assets map[string]Content
 
+// raw returns a reader of the content as it is shipped
+func (c Content) raw() io.Reader {
+	if c.section != nil {
+		return io.NewSectionReader(c.section, 0, c.section.Size())
+	}
+	if c.Chunks != nil {
+		readers := make([]io.Reader, len(c.Chunks))
+		for i, chunk := range c.Chunks {
+			readers[i] = chunk.raw()
+		}
+		return io.MultiReader(readers...)
+	}
+	if c.Bytes != nil {
+		return bytes.NewReader(c.Bytes)
+	}
+	return strings.NewReader(c.Str)
+}
+
+// Reader returns a reader of the uncompressed content
+func (c Content) Reader() (io.ReadCloser, error) {
+	if c.Gziped {
+		return gzip.NewReader(c.raw())
+	}
+	return ioutil.NopCloser(c.raw()), nil
+}
+
+// Data reads all the uncompressed content. The uncompressed Bytes are
+// returned as they are, which are shared by all the callers and must not be
+// modified
+func (c Content) Data() ([]byte, error) {
+	if !c.Gziped && c.Bytes != nil {
+		return c.Bytes, nil
+	}
+	r, err := c.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// chunked puts the given chunk as the i-th chunk of the content
+func (c Content) chunked(i int, chunk Content) Content {
+	for len(c.Chunks) <= i {
+		c.Chunks = append(c.Chunks, Content{})
+	}
+	c.Chunks[i] = chunk
+	c.Gziped, c.Soname, c.Needed = chunk.Gziped, chunk.Soname, chunk.Needed
+	c.Machine, c.Class, c.Order = chunk.Machine, chunk.Class, chunk.Order
+	return c
+}
+
 func ckdir(dir string) error {
 	// check directory
 	if stat, err := os.Stat(dir); err != nil {
 		if !os.IsNotExist(err) {
 			return err
 		}
-		os.MkdirAll(dir, 0666)
+		return os.MkdirAll(dir, 0755)
 	} else if !stat.IsDir() {
 		return errors.New("a same name non-folder file exists")
 	}
 	return nil
 }
 
+// Get returns the content mapped to the given name
+func (as *Assets) Get(name string) (Content, bool) {
+	if d := developing(as); d != nil {
+		return d.Get(name)
+	}
+	content, ok := (*as)[name]
+	if ok && content.Ref != "" {
+		content, ok = (*as)[content.Ref]
+	}
+	return content, ok
+}
+
+// Names returns the sorted names of all the contents
+func (as *Assets) Names() []string {
+	if d := developing(as); d != nil {
+		return d.Names()
+	}
+	names := make([]string, 0, len(*as))
+	for name := range *as {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Put maps the given name to the content, which is used by the sharded
+// shipped files to register their contents at init
+func (as *Assets) Put(name string, content Content) {
+	(*as)[name] = content
+}
+
+// PutChunk puts the i-th chunk of the content mapped to the given name
+func (as *Assets) PutChunk(name string, i int, chunk Content) {
+	(*as)[name] = (*as)[name].chunked(i, chunk)
+}
+
 // Restore restores the underlying contents to the current working directory
 // with its original name
 func (as *Assets) Restore(names ...string) error {
+	return restore(as, names...)
+}
+
+// RestoreAs restores the underlying contents to the given dest path
+func (as *Assets) RestoreAs(name string, dest string) error {
+	return restoreAs(as, name, dest)
+}
+
+func restore(c Cargo, names ...string) error {
 	wd, err := os.Getwd()
 	if err != nil {
 		return err
 	}
-	for _, name := range names {
-		err := as.RestoreAs(name, filepath.Join(wd, name))
+	// the shared libraries are restored after the ones they need
+	for _, name := range ordered(c, names) {
+		err := c.RestoreAs(name, filepath.Join(wd, name))
 		if err != nil {
 			return err
 		}
@@ -44,10 +184,52 @@ func (as *Assets) Restore(names ...string) error {
 	return nil
 }
 
-// RestoreAs restores the underlying contents to the given dest path
-func (as *Assets) RestoreAs(name string, dest string) error {
-	content := (*as)[name]
-	if content.Bytes != nil {
+// RestoreTemp restores the given contents of the cargo to a new temporary
+// directory with their names, it returns the directory along with the
+// function removing it, which is safe to be called multiple times
+func RestoreTemp(c Cargo, names ...string) (dir string, cleanup func() error, err error) {
+	dir, cleanup, err = tempdir("shipper-")
+	if err != nil {
+		return "", nil, err
+	}
+	// the shared libraries are restored after the ones they need
+	for _, name := range ordered(c, names) {
+		if err := c.RestoreAs(name, filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			cleanup()
+			return "", nil, err
+		}
+	}
+	return dir, cleanup, nil
+}
+
+// tempdir makes a new temporary directory along with the function removing
+// it, which is safe to be called multiple times
+func tempdir(pattern string) (string, func() error, error) {
+	dir, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return "", nil, err
+	}
+	var mu sync.Mutex
+	removed := false
+	return dir, func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if removed {
+			return nil
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		removed = true
+		return nil
+	}, nil
+}
+
+func restoreAs(c Cargo, name string, dest string) error {
+	if content, ok := c.Get(name); ok {
+		if err := runnable(name, content); err != nil {
+			return err
+		}
 		// check directory
 		if err := ckdir(filepath.Dir(dest)); err != nil {
 			return err
@@ -59,15 +241,15 @@ func (as *Assets) RestoreAs(name string, dest string) error {
 		}
 		defer f.Close()
 
-		data := content.Bytes
-		if content.Gziped {
-			data, err = UnGzip(content.Bytes)
-			if err != nil {
-				return err
-			}
+		r, err := content.Reader()
+		if err != nil {
+			return err
 		}
-		_, err = f.Write(data)
-		return err
+		defer r.Close()
+		if _, err = io.Copy(f, r); err != nil || content.Soname == "" {
+			return err
+		}
+		return link(dest, content.Soname)
 	}
 	return errors.New("could not find contents mapped to the given filename " + name)
 }
@@ -0,0 +1,163 @@
+package shipper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// server serves the contents of the cargo by their names
+type server struct {
+	cargo Cargo
+	// etags caches the digests of the contents by their names
+	etags sync.Map
+}
+
+// etag returns the entity tag of the content of the given name, which is the
+// digest of the content as it is shipped
+func (s *server) etag(name string, content Content) (string, error) {
+	if tag, ok := s.etags.Load(name); ok {
+		return tag.(string), nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, content.raw()); err != nil {
+		return "", err
+	}
+	tag := `"` + hex.EncodeToString(h.Sum(nil))[:32]
+	if !content.live {
+		s.etags.Store(name, tag)
+	}
+	return tag, nil
+}
+
+// seeker returns a seekable reader of the given reader, which is read all
+// unless it is seekable itself
+func seeker(r io.Reader) (io.ReadSeeker, error) {
+	if rs, ok := r.(io.ReadSeeker); ok {
+		return rs, nil
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// accepts tells whether the given Accept-Encoding header accepts the given
+// coding, which is told by the item naming it rather than the "*" one
+func accepts(header string, coding string) bool {
+	star := false
+	for _, item := range strings.Split(header, ",") {
+		params := strings.Split(item, ";")
+		name := strings.TrimSpace(params[0])
+		if name != coding && name != "*" {
+			continue
+		}
+		accepted := true
+		for _, param := range params[1:] {
+			if q := strings.TrimSpace(param); strings.HasPrefix(q, "q=") {
+				if v, err := strconv.ParseFloat(q[2:], 64); err == nil && v == 0 {
+					accepted = false
+				}
+			}
+		}
+		if name == coding {
+			return accepted
+		}
+		star = accepted
+	}
+	return star
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	content, ok := s.cargo.Get(name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	tag, err := s.etag(name, content)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the stored compressed content is served as it is when acceptable
+	var body io.Reader
+	if content.Gziped {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if accepts(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			body, tag = content.raw(), tag+`-gzip`
+		}
+	}
+	if body == nil && !content.Gziped {
+		// the contents but the chunked ones are seekable as they are
+		body = content.raw()
+	}
+	if body == nil {
+		rc, err := content.Reader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rc.Close()
+		body = rc
+	}
+	rs, err := seeker(body)
+	if err != nil {
+		w.Header().Del("Content-Encoding")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype == "" {
+		ctype, err = sniff(content)
+		if err != nil {
+			w.Header().Del("Content-Encoding")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("ETag", tag+`"`)
+	http.ServeContent(w, r, name, time.Time{}, rs)
+}
+
+// sniff detects the content type by the leading bytes of the uncompressed
+// content
+func sniff(content Content) (string, error) {
+	r, err := content.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	var buf [512]byte
+	n, err := io.ReadFull(r, buf[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// Handler returns the http.Handler serving the contents of the cargo by the
+// names in the url paths. It serves the gziped contents as they are to the
+// clients accepting gzip
+func Handler(c Cargo) http.Handler {
+	return &server{cargo: c}
+}
@@ -0,0 +1,48 @@
+package shipper
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Libraries restores the given shared libraries of the cargo into a private
+// directory by their base names, which must not collide. It returns the
+// environment for exec.Cmd.Env with the directory prepended to
+// LD_LIBRARY_PATH, along with the function removing the directory
+func Libraries(c Cargo, names ...string) (env []string, cleanup func() error, err error) {
+	// the libraries are looked up by their base names in the directory
+	bases := map[string]string{}
+	for _, name := range names {
+		if other, ok := bases[path.Base(name)]; ok && other != name {
+			return nil, nil, errors.New("the libraries " + other + " and " + name + " have the same base name")
+		}
+		bases[path.Base(name)] = name
+	}
+	dir, cleanup, err := tempdir("shipper-lib-")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range ordered(c, names) {
+		if err := c.RestoreAs(name, filepath.Join(dir, path.Base(name))); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+	}
+
+	const key = "LD_LIBRARY_PATH="
+	env = os.Environ()
+	for i, kv := range env {
+		if strings.HasPrefix(kv, key) {
+			value := dir
+			if old := strings.TrimPrefix(kv, key); old != "" {
+				value += string(os.PathListSeparator) + old
+			}
+			env[i] = key + value
+			return env, cleanup, nil
+		}
+	}
+	return append(env, key+dir), cleanup, nil
+}
@@ -0,0 +1,108 @@
+package shipper
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Listing tells how a file in the directory is shipped or why it is not
+type Listing struct {
+	Path    string `json:"path"`              // relative to the directory
+	Key     string `json:"key,omitempty"`     // the name it is shipped as
+	Include string `json:"include,omitempty"` // the filename of the matching include
+	Gziped  bool   `json:"gziped"`
+	Size    int64  `json:"size"`
+	Shipped int64  `json:"shipped"`       // the size of the shipped contents
+	Ref     string `json:"ref,omitempty"` // the key of the identical contents shipped instead
+	Reason  string `json:"reason,omitempty"`
+}
+
+// List lists every file in the directory of the given meta along with how it
+// would be shipped, nothing is shipped
+func List(meta Meta) ([]Listing, error) {
+	stat, err := os.Stat(meta.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if !stat.IsDir() {
+		return nil, errors.New("invalid directory")
+	}
+
+	var listings []Listing
+	var entries []entry
+	err = traverse(meta.Dir, "", func(root string, dir string, filename string) {
+		name := path.Join(dir, filename)
+		fullpath := filepath.Join(root, dir, filename)
+		l := Listing{Path: filepath.ToSlash(name)}
+		if stat, err := os.Stat(fullpath); err == nil {
+			l.Size = stat.Size()
+		}
+
+		include, ok := meta.match(fullpath)
+		if !ok {
+			patterns := make([]string, len(meta.Includes))
+			for i, include := range meta.Includes {
+				patterns[i] = include.Filename
+			}
+			l.Reason = "matches none of the includes " + strings.Join(patterns, ", ")
+		} else {
+			e := meta.entry(name, include, file(func() (fs.File, error) { return os.Open(fullpath) }))
+			l.Key, l.Include, l.Gziped = e.Filename, include.Filename, include.Gziped
+			entries = append(entries, e)
+		}
+		listings = append(listings, l)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	all := map[string]entry{}
+	for _, e := range entries {
+		all[e.Filename] = e
+	}
+	// the files failing to be read are told by measure, while the identical
+	// ones refer to the first of them in the order they are shipped
+	refs := map[string]string{}
+	ordering(entries)
+	entries, _ = dedup(entries)
+	for _, e := range entries {
+		refs[e.Filename] = e.Ref
+	}
+	for i, l := range listings {
+		if l.Key == "" {
+			continue
+		}
+		if ref := refs[l.Key]; ref != "" {
+			listings[i].Ref, listings[i].Shipped = ref, 0
+			continue
+		}
+		if listings[i].Shipped, err = measure(all[l.Key]); err != nil {
+			listings[i].Reason = err.Error()
+		}
+	}
+	sort.SliceStable(listings, func(i, j int) bool {
+		return listings[i].Path < listings[j].Path
+	})
+	return listings, nil
+}
+
+// measure measures the size of the contents of the given entry once shipped
+func measure(e entry) (int64, error) {
+	f, _, err := e.open()
+	if err != nil {
+		return -1, err
+	}
+	defer f.Close()
+
+	c := &counter{w: ioutil.Discard}
+	if err := pack(c, f, e.Gziped, nil); err != nil {
+		return -1, err
+	}
+	return c.n, nil
+}
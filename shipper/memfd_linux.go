@@ -0,0 +1,109 @@
+package shipper
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// memfdCreate maps the architectures to the number of memfd_create, which is
+// missing from the syscall package of some of them
+var memfdCreate = map[string]uintptr{
+	"386":      356,
+	"amd64":    319,
+	"arm":      385,
+	"arm64":    279,
+	"loong64":  279,
+	"mips":     4354,
+	"mipsle":   4354,
+	"mips64":   5314,
+	"mips64le": 5314,
+	"ppc64":    360,
+	"ppc64le":  360,
+	"riscv64":  279,
+	"s390x":    350,
+}
+
+// mfdCloexec is MFD_CLOEXEC of memfd_create
+const mfdCloexec = 1
+
+// memfds keeps the memfds of the executables open by the digests of their
+// contents, so that an unchanged one is written only once
+var memfds = struct {
+	sync.Mutex
+	files map[[sha256.Size]byte]*os.File
+}{files: map[[sha256.Size]byte]*os.File{}}
+
+// memfd writes the executable of the given name in the cargo to a memfd and
+// returns the path of it in /proc/self/fd
+func memfd(c Cargo, name string) (string, error) {
+	content, ok := c.Get(name)
+	if !ok {
+		return "", errors.New("could not find contents mapped to the given filename " + name)
+	}
+	if err := runnable(name, content); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, content.raw()); err != nil {
+		return "", err
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+
+	memfds.Lock()
+	defer memfds.Unlock()
+	if f, ok := memfds.files[sum]; ok {
+		return "/proc/self/fd/" + strconv.Itoa(int(f.Fd())), nil
+	}
+	nr, ok := memfdCreate[runtime.GOARCH]
+	if !ok {
+		return "", errors.New("memfd_create is unknown on " + runtime.GOARCH)
+	}
+	p, err := syscall.BytePtrFromString(path.Base(name))
+	if err != nil {
+		return "", err
+	}
+	fd, _, errno := syscall.Syscall(nr, uintptr(unsafe.Pointer(p)), mfdCloexec, 0)
+	if errno != 0 {
+		return "", os.NewSyscallError("memfd_create", errno)
+	}
+	w := os.NewFile(fd, path.Base(name))
+	defer w.Close()
+	r, err := content.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	if _, err := io.Copy(w, r); err != nil {
+		return "", err
+	}
+
+	// the file open for writing is busy thus could not be executed
+	f, err := os.Open("/proc/self/fd/" + strconv.Itoa(int(fd)))
+	if err != nil {
+		return "", err
+	}
+	memfds.files[sum] = f
+	return "/proc/self/fd/" + strconv.Itoa(int(f.Fd())), nil
+}
+
+// MemCommand returns the command running the shipped executable of the given
+// name in the cargo with the given arguments without writing it to the disk.
+// The executable is written to a memfd and run as /proc/self/fd/N, the memfd
+// is kept open for the same one to be run again
+func MemCommand(c Cargo, name string, args ...string) (*exec.Cmd, error) {
+	exe, err := memfd(c, name)
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(exe, args...), nil
+}
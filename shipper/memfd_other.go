@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package shipper
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// MemCommand fails for running the shipped executables without writing them
+// to the disk needs memfd_create, which is only available on linux
+func MemCommand(c Cargo, name string, args ...string) (*exec.Cmd, error) {
+	return nil, errors.New("running without writing to the disk needs memfd_create of linux")
+}
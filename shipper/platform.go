@@ -0,0 +1,57 @@
+package shipper
+
+import (
+	"runtime"
+	"strings"
+)
+
+// Platform is the view of the contents shipped for a platform, which are laid
+// out as <goos>_<goarch>/... and named without the platform directory
+type Platform struct {
+	cargo  Cargo
+	prefix string
+}
+
+// platform makes the view of the given cargo for the given platform
+func platform(c Cargo, goos string, goarch string) *Platform {
+	return &Platform{cargo: c, prefix: goos + "_" + goarch + "/"}
+}
+
+// ForPlatform returns the view of the contents shipped for the running
+// platform
+func (as *Assets) ForPlatform() *Platform {
+	return platform(as, runtime.GOOS, runtime.GOARCH)
+}
+
+// ForPlatform returns the view of the contents shipped for the running
+// platform
+func (t *Table) ForPlatform() *Platform {
+	return platform(t, runtime.GOOS, runtime.GOARCH)
+}
+
+// Get returns the content of the given name in the platform directory
+func (p *Platform) Get(name string) (Content, bool) {
+	return p.cargo.Get(p.prefix + name)
+}
+
+// Names returns the sorted names of all the contents in the platform directory
+func (p *Platform) Names() []string {
+	var names []string
+	for _, name := range p.cargo.Names() {
+		if strings.HasPrefix(name, p.prefix) {
+			names = append(names, strings.TrimPrefix(name, p.prefix))
+		}
+	}
+	return names
+}
+
+// Restore restores the underlying contents to the current working directory
+// with its name in the platform directory
+func (p *Platform) Restore(names ...string) error {
+	return restore(p, names...)
+}
+
+// RestoreAs restores the underlying contents to the given dest path
+func (p *Platform) RestoreAs(name string, dest string) error {
+	return restoreAs(p, name, dest)
+}
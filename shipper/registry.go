@@ -0,0 +1,88 @@
+package shipper
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// registry maps the namespaces to the cargoes registered by the shipped go
+// files across packages
+var registry = struct {
+	sync.RWMutex
+	cargoes map[string]Cargo
+}{cargoes: map[string]Cargo{}}
+
+// Register registers the cargo under the given namespace, which is called by
+// the shipped go files at init. It panics if the namespace is invalid, or if
+// it is registered already so that a duplicate namespace never goes unnoticed
+func Register(ns string, c Cargo) {
+	if err := namespace(ns); err != nil {
+		panic(err)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.cargoes[ns]; ok {
+		panic("shipper: the namespace " + ns + " is registered twice")
+	}
+	registry.cargoes[ns] = c
+}
+
+// unregister removes the cargo registered under the given namespace, which is
+// only for the tests
+func unregister(ns string) {
+	registry.Lock()
+	defer registry.Unlock()
+	delete(registry.cargoes, ns)
+}
+
+// namespace checks the validity of the given namespace
+func namespace(ns string) error {
+	if ns == "" {
+		return errors.New("shipper: empty namespace")
+	}
+	if strings.Contains(ns, ":") {
+		return errors.New("shipper: the namespace " + ns + " should not contain a colon")
+	}
+	return nil
+}
+
+// Lookup returns the cargo registered under the given namespace
+func Lookup(ns string) (Cargo, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	c, ok := registry.cargoes[ns]
+	return c, ok
+}
+
+// Namespaces returns the sorted namespaces registered
+func Namespaces() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	names := make([]string, 0, len(registry.cargoes))
+	for ns := range registry.cargoes {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the uncompressed content of the given name like "ns:path", which
+// is the path in the cargo registered under the namespace ns
+func Open(name string) (io.ReadCloser, error) {
+	i := strings.Index(name, ":")
+	if i < 0 {
+		return nil, errors.New("the name " + name + " should be like ns:path")
+	}
+	c, ok := Lookup(name[:i])
+	if !ok {
+		return nil, errors.New("could not find the namespace " + name[:i])
+	}
+	content, ok := c.Get(name[i+1:])
+	if !ok {
+		return nil, errors.New("could not find contents mapped to the given filename " + name)
+	}
+	return content.Reader()
+}
@@ -1,12 +1,21 @@
 package shipper
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"go/build/constraint"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 	"unicode"
@@ -23,11 +32,128 @@ type Include struct {
 
 // Meta carries the metadata for templates and shipping process
 type Meta struct {
-	Tags     string
+	Tags     string // a //go:build expression or a legacy +build line
 	Package  string
 	VarName  string
 	Dir      string    // ship from
 	Includes []Include // including
+	Stringed bool      // ship contents as string literals instead of []byte
+	Table    bool      // ship a sorted shipper.Table instead of shipper.Assets
+	// ShardSize is the maximum bytes of contents in a single shipped file, the
+	// contents are sharded into files named after the destfile if it is given
+	ShardSize int64
+	// Asm ships the contents as go assembly in a .s file named after the
+	// destfile, leaving only the declarations to the go file
+	Asm bool
+	// Appended ships the loader of the assets appended to the executable by
+	// Append, instead of the contents
+	Appended bool
+	// Lenient leaves out the files failing to be read and reports them as
+	// warnings by Warn, or by the standard logger if Warn is nil
+	Lenient bool
+	Warn    func(error)
+	// Standalone ships private copies of the shipper types along with the
+	// contents so that the shipped files depend on nothing but the stdlib
+	Standalone bool
+	// Template is the file of the user templates overriding the built-in ones
+	// of the same names. The "header", "fore" and "aft" templates are given
+	// the Meta, while "entryStart" and "entryEnd" are given the entry with its
+	// .Filename, .Size, .Hash (hex sha256), .Codec ("gzip" or empty) and .Meta,
+	// between which the contents are written as "\xNN" escapes. The entry
+	// identical with an earlier one is written by "ref" instead, with the name
+	// of that one as .Ref. Both write the "key" and the "closing" of the entry.
+	// The "decls" template is given the assembly symbols with .Name and .Size
+	Template string
+	// Dev ships the call of Develop at init, which makes the shipped variable
+	// read the included files in the dir from the disk in the development
+	// mode turned on by the shipper_dev build tag or the SHIPPER_DEV env. The
+	// init panics in the development mode if the dir could not be found
+	Dev bool
+	// Namespace ships the call of Register at init, which registers the
+	// shipped variable under it to be found by Lookup and Open
+	Namespace string
+}
+
+// Errors aggregates the errors occurred while shipping
+type Errors []error
+
+func (es Errors) Error() string {
+	msgs := make([]string, len(es))
+	for i, err := range es {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// add adds the given error if it is not nil, the aggregated ones are
+// flattened
+func (es Errors) add(err error) Errors {
+	if more, ok := err.(Errors); ok {
+		return append(es, more...)
+	}
+	if err != nil {
+		return append(es, err)
+	}
+	return es
+}
+
+// err returns the aggregated errors or nil if there is none
+func (es Errors) err() error {
+	if len(es) == 0 {
+		return nil
+	}
+	return es
+}
+
+// entry carries the data of a single asset entry for templates
+type entry struct {
+	Filename   string
+	Gziped     bool
+	Stringed   bool
+	Table      bool
+	VarName    string
+	Sharded    bool
+	Standalone bool
+	Chunked    bool
+	Chunk      int
+	Symbol     string   // the symbol defined in assembly carrying the contents
+	Ref        string   // the name of the entry carrying the identical contents
+	Size       int64    // the size of the contents before being shipped
+	Hash       string   // the hex encoded sha256 of the contents
+	Codec      string   // "gzip" if the contents are gziped or else empty
+	Soname     string   // the SONAME of an ELF shared library
+	Needed     []string // the DT_NEEDED entries of an ELF shared library
+	Machine    string   // the machine of an ELF file like EM_X86_64
+	Class      string   // the class of an ELF file like ELFCLASS64
+	Order      string   // the byte order of an ELF file like ELFDATA2LSB
+	Meta       *Meta
+	include    string // the filename of the matching include
+	open       opener
+}
+
+// opener opens the contents of an entry along with their size
+type opener func() (io.ReadCloser, int64, error)
+
+// file opens the file by the given open function as the contents
+func file(open func() (fs.File, error)) opener {
+	return func() (io.ReadCloser, int64, error) {
+		f, err := open()
+		if err != nil {
+			return nil, -1, err
+		}
+		stat, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, -1, err
+		}
+		return f, stat.Size(), nil
+	}
+}
+
+// symbol is a symbol defined in assembly of the given size
+type symbol struct {
+	Name string
+	Size int64
 }
 
 // Shipped moulds the shipped go file's content
@@ -42,52 +168,215 @@ var shipped = template.New("shipped").Funcs(template.FuncMap{
 		}
 		return "", errors.New("the given string must start with a letter")
 	},
+	"quote": strconv.Quote,
+	"build": func(tags string) (string, error) {
+		expr, err := constrain(tags)
+		if err != nil {
+			return "", err
+		}
+		lines, err := constraint.PlusBuildLines(expr)
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(append([]string{"//go:build " + expr.String()}, lines...), "\n"), nil
+	},
+	"low": func(s string) string {
+		runes := []rune(s)
+		runes[0] = unicode.ToLower(runes[0])
+		return string(runes)
+	},
 })
 
-// Fore moulds the fore part of the shipped go file
-var fore = template.Must(shipped.New("fore").Parse(`// Code generated by shipper; DO NOT EDIT.
+// Header moulds the header shared by all the shipped go files
+var header = template.Must(shipped.New("header").Parse(`// Code generated by shipper; DO NOT EDIT.
 
-{{with .Tags}}// +build {{.}}
+{{with .Tags}}{{build .}}
 
 {{end}}package {{.Package}}
-
+{{if not .Standalone}}
 import (
 	"github.com/sinloss/shipper/shipper"
 )
+{{end}}`))
+
+// Qualifier moulds the qualifier of the shipper types, which are the private
+// ones named after the variable if standalone
+var qualifier = template.Must(shipped.New("qualifier").Parse(
+	`{{if .Standalone}}{{low .VarName}}{{else}}shipper.{{end}}`))
+
+// Cargo moulds the type of the shipped variable
+var cargo = template.Must(shipped.New("cargo").Parse(
+	`{{template "qualifier" .}}{{if .Table}}Table{{else}}Assets{{end}}`))
 
+// Fore moulds the fore part of the shipped go file
+var fore = template.Must(shipped.New("fore").Parse(`{{template "header" .}}
+{{- if .Standalone}}{{template "standalone" .}}{{end}}
+{{- template "develop" .}}
+{{- template "register" .}}
 // {{cap .VarName}} is the Asset
-var {{cap .VarName}} = &shipper.Assets{
+var {{cap .VarName}} = &{{template "cargo" .}}{
 `))
 
+// Develop moulds the init reading the included files from the dir in the
+// development mode
+var develop = template.Must(shipped.New("develop").Parse(`{{if .Dev}}
+func init() {
+	if err := shipper.Develop({{cap .VarName}}, {{quote .Dir}}
+		{{- range .Includes}}, {{quote .Filename}}{{end}}); err != nil {
+		panic(err)
+	}
+}
+{{end}}`))
+
+// Register moulds the init registering the shipped variable under the
+// namespace
+var register = template.Must(shipped.New("register").Parse(`{{with .Namespace}}
+func init() {
+	shipper.Register({{quote .}}, {{cap $.VarName}})
+}
+{{end}}`))
+
+// Loader moulds the shipped go file loading the assets appended to the
+// executable
+var loader = template.Must(shipped.New("loader").Parse(`{{template "header" .}}
+// {{cap .VarName}} is the Asset appended to the executable, which is empty if
+// it fails to load for the reason of {{cap .VarName}}Err
+var {{cap .VarName}}, {{cap .VarName}}Err = shipper.Appended()
+{{template "develop" .}}
+{{- template "register" .}}`))
+
+// ShardFore moulds the fore part of a shard of the shipped go file
+var shardFore = template.Must(shipped.New("shardFore").Parse(`{{template "header" .}}
+func init() {`))
+
+// Key moulds the key part of an asset entry
+var key = template.Must(
+	shipped.New("key").Parse(`
+	{{- if .Sharded}}{{cap .VarName}}.{{if .Chunked}}PutChunk({{quote .Filename}}, {{.Chunk}}, {{else}}Put({{quote .Filename}}, {{end -}}
+	{{else if .Table}}{Name: {{quote .Filename}}, Content: {{else}}{{quote .Filename}}: {{end}}`))
+
+// Closing moulds the closing part of an asset entry
+var closing = template.Must(
+	shipped.New("closing").Parse(`{{if .Sharded}}){{else if .Table}}},{{else}},{{end}}`))
+
 // EntryStart moulds the start part of an asset entry
 var entryStart = template.Must(
 	shipped.New("entryStart").Parse(`
-	"{{.Filename}}": shipper.Content{
+	{{template "key" .}}{{template "qualifier" .}}Content{
 		Gziped: {{.Gziped}},
-		Bytes:  []byte("`))
+		{{- if and .Soname (not .Standalone)}}
+		Soname: {{quote .Soname}},
+		{{- end}}
+		{{- if and .Needed (not .Standalone)}}
+		Needed: []string{ {{- range $i, $n := .Needed}}{{if $i}}, {{end}}{{quote $n}}{{end}}},
+		{{- end}}
+		{{- if and .Machine (not .Standalone)}}
+		Machine: {{quote .Machine}},
+		Class: {{quote .Class}},
+		Order: {{quote .Order}},
+		{{- end}}
+		{{if .Symbol}}Bytes:  {{.Symbol}}[:]{{else if .Stringed}}Str:    "{{else}}Bytes:  []byte("{{end}}`))
 
-// EntryStart moulds the end part of an asset entry
+// EntryEnd moulds the end part of an asset entry
 var entryEnd = template.Must(
-	shipped.New("entryEnd").Parse(`"),
-	},`))
+	shipped.New("entryEnd").Parse(`{{if not .Symbol}}"{{if not .Stringed}}){{end}}{{end}},
+	}{{template "closing" .}}`))
+
+// Ref moulds an asset entry referring to the identical content of another
+var ref = template.Must(
+	shipped.New("ref").Parse(`
+	{{template "key" .}}{{template "qualifier" .}}Content{Ref: {{quote .Ref}}}{{template "closing" .}}`))
 
 // Aft moulds the aft part of the shipped go file
-var aft = template.Must(shipped.New("Aft").Parse(`
+var aft = template.Must(shipped.New("aft").Parse(`
 }`))
 
+// Decls moulds the declarations of the symbols defined in assembly
+var decls = template.Must(shipped.New("decls").Parse(`{{if .}}
+
+// the contents are defined in assembly as read-only data, which must never
+// be written
+var (
+{{- range .}}
+	{{.Name}} [{{.Size}}]byte
+{{- end}}
+){{end}}`))
+
+// AsmFore moulds the fore part of the shipped assembly file
+var asmFore = template.Must(shipped.New("asmFore").Parse(`// Code generated by shipper; DO NOT EDIT.
+
+{{with .Tags}}{{build .}}
+
+{{end}}#include "textflag.h"
+
+`))
+
+// traverse calls back with every file in the dir of the root, the broken
+// symlinks included so that they fail to be read
 func traverse(root string, dir string, callback func(string, string, string)) error {
 	d, err := ioutil.ReadDir(path.Join(root, dir))
 	if err != nil {
 		return err
 	}
+	var errs Errors
 	for _, fi := range d {
 		if fi.IsDir() {
-			traverse(root, path.Join(dir, fi.Name()), callback)
-		} else {
+			errs = errs.add(traverse(root, path.Join(dir, fi.Name()), callback))
+			continue
+		}
+		// the symlinks are followed to the files only, the other non-regular
+		// files like the symlinked directories are skipped
+		mode := fi.Mode()
+		if mode&os.ModeSymlink != 0 {
+			if stat, err := os.Stat(filepath.Join(root, dir, fi.Name())); err == nil {
+				mode = stat.Mode()
+			}
+		}
+		if mode.IsRegular() || mode&os.ModeSymlink != 0 {
 			callback(root, dir, fi.Name())
 		}
 	}
-	return nil
+	return errs.err()
+}
+
+// templates loads the user templates overriding the built-in ones of the
+// same names, or the built-in ones if there is none
+func (meta *Meta) templates() (*template.Template, error) {
+	if meta.Template == "" {
+		return shipped, nil
+	}
+	text, err := ioutil.ReadFile(meta.Template)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := shipped.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmpl.Parse(string(text)); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// constrain parses the build tags as a //go:build expression, or as the tags of
+// a legacy build line if they are not one
+func constrain(tags string) (constraint.Expr, error) {
+	expr, err := constraint.Parse("//go:build " + tags)
+	if err == nil {
+		return expr, nil
+	}
+	// the legacy line ignores whatever it does not understand thus must be
+	// checked first
+	legacy := strings.IndexFunc(tags, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("_.,! ", r)
+	}) == -1
+	if legacy {
+		if expr, err := constraint.Parse("// +build " + tags); err == nil {
+			return expr, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid build tags %q: %v", tags, err)
 }
 
 // Including adds a suit of include to the includes array
@@ -108,78 +397,308 @@ func (meta *Meta) Including(filename string, gziped bool) error {
 	return nil
 }
 
-// Ship ships the given set of files to a destfile
+// match finds the include matching the given file path, the first matching
+// include wins
+func (meta *Meta) match(fullpath string) (Include, bool) {
+	for _, include := range meta.Includes {
+		if include.Wc.Search([]rune(fullpath), true).AllMatching() {
+			return include, true
+		}
+	}
+	return Include{}, false
+}
+
+// entry makes the entry of the given file matching the given include
+func (meta *Meta) entry(filename string, include Include, open opener) entry {
+	var codec string
+	if include.Gziped {
+		codec = "gzip"
+	}
+	return entry{
+		Filename:   filepath.ToSlash(filename),
+		Gziped:     include.Gziped,
+		Stringed:   meta.Stringed,
+		Standalone: meta.Standalone,
+		Table:      meta.Table,
+		VarName:    meta.VarName,
+		Sharded:    meta.ShardSize > 0,
+		Codec:      codec,
+		Meta:       meta,
+		include:    include.Filename,
+		open:       open}
+}
+
+// collect collects the entries of all the included files in order
+func collect(meta Meta) ([]entry, error) {
+	var entries []entry
+	err := traverse(meta.Dir, "", func(root string, dir string, filename string) {
+		fullpath := filepath.Join(root, dir, filename)
+		if include, ok := meta.match(fullpath); ok {
+			entries = append(entries, meta.entry(path.Join(dir, filename), include,
+				file(func() (fs.File, error) { return os.Open(fullpath) })))
+		}
+	})
+	ordering(entries)
+	return entries, err
+}
+
+// ordering sorts the entries by their names, in which order they are deduped
+// and shipped. A table is looked up by binary search thus must be sorted
+func ordering(entries []entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Filename < entries[j].Filename
+	})
+}
+
+// dedup refers the entries with identical contents to the first one of them
+// so that the contents are shipped only once, the entries are measured and
+// hashed meanwhile. The entries failing to be read are left out
+func dedup(entries []entry) ([]entry, error) {
+	var errs Errors
+	var kept []entry
+	firsts := map[[sha256.Size]byte]string{}
+	for _, e := range entries {
+		f, _, err := e.open()
+		if err != nil {
+			errs = errs.add(err)
+			continue
+		}
+		h := sha256.New()
+		e.Size, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			errs = errs.add(err)
+			continue
+		}
+
+		var sum [sha256.Size]byte
+		copy(sum[:], h.Sum(nil))
+		e.Hash = hex.EncodeToString(sum[:])
+		if first, ok := firsts[sum]; ok {
+			e.Ref = first
+		} else {
+			firsts[sum] = e.Filename
+		}
+		kept = append(kept, e)
+	}
+	return kept, errs.err()
+}
+
+// pack writes the contents read from the reader to the writer, compressed if
+// it is gziped
+func pack(w io.Writer, r io.Reader, gziped bool, buf []byte) error {
+	if !gziped {
+		_, err := io.CopyBuffer(w, r, buf)
+		return err
+	}
+	zw := gzipper(w)
+	if _, err := io.CopyBuffer(zw, r, buf); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Ship ships the given set of files to a destfile. The shipped files are
+// written to temporary files first, which replace the destfile and its shards
+// and assembly only if all of them are successfully shipped
 func Ship(meta Meta, destfile string) error {
-	// check meta validity
-	if len(meta.Includes) == 0 {
-		return errors.New("not a single file is included")
+	return NewBundle(meta).AddIncluded().Ship(destfile)
+}
+
+// shipment tracks the go files being shipped to
+type shipment struct {
+	meta     Meta
+	tmpl     *template.Template
+	destfile string
+	create   func(string) (io.WriteCloser, error)
+	shard    int            // index of the current shard
+	main     io.WriteCloser // the destfile
+	dest     io.WriteCloser // the destfile or the current shard
+	wo       io.Writer      // the writer of the contents
+	left     int64          // bytes left in the current shard
+	asmfile  io.WriteCloser
+	asm      *bufio.Writer
+	symbols  []symbol
+}
+
+// close closes all the files being shipped to
+func (s *shipment) close() error {
+	var errs Errors
+	if s.asm != nil {
+		errs = errs.add(s.asm.Flush())
 	}
-	if meta.Package == "" {
-		return errors.New("empty package")
+	if s.asmfile != nil {
+		errs = errs.add(s.asmfile.Close())
 	}
-	if meta.VarName == "" {
-		return errors.New("empty variable name")
+	if s.dest != nil && s.dest != s.main {
+		errs = errs.add(s.dest.Close())
 	}
-	if filepath.Ext(destfile) != ".go" {
-		return errors.New("destfile should be a go file")
+	if s.main != nil {
+		errs = errs.add(s.main.Close())
 	}
+	return errs.err()
+}
 
-	// check dir validity
-	stat, err := os.Stat(meta.Dir)
+// shardname names the i-th shard after the destfile
+func shardname(destfile string, i int) string {
+	return fmt.Sprintf("%s_%03d.go", strings.TrimSuffix(destfile, ".go"), i)
+}
+
+// asmname names the assembly file after the destfile
+func asmname(destfile string) string {
+	return strings.TrimSuffix(destfile, ".go") + ".s"
+}
+
+// extras finds the shards and the assembly of a previous shipping to the
+// destfile
+func extras(destfile string) ([]string, error) {
+	candidates, err := filepath.Glob(strings.TrimSuffix(destfile, ".go") + "_[0-9][0-9][0-9].go")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(asmname(destfile)); err == nil {
+		candidates = append(candidates, asmname(destfile))
+	}
+	var found []string
+	marker := []byte("// Code generated by shipper; DO NOT EDIT.")
+	for _, candidate := range candidates {
+		// never touch the files that are not shipped by shipper
+		data, err := ioutil.ReadFile(candidate)
+		if err != nil || !bytes.HasPrefix(data, marker) {
+			continue
+		}
+		found = append(found, candidate)
+	}
+	return found, nil
+}
+
+// clean removes the stale shards and assembly of a previous shipping to the
+// destfile, which are not among the given shipped files
+func clean(destfile string, shipped map[string]string) error {
+	found, err := extras(destfile)
 	if err != nil {
 		return err
 	}
-	if !stat.IsDir() {
-		return errors.New("invalid directory")
+	for _, extra := range found {
+		if _, ok := shipped[extra]; ok {
+			continue
+		}
+		if err := os.Remove(extra); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// check dest file's directory
-	if err := ckdir(filepath.Dir(destfile)); err != nil {
+// rotate closes the current shard and starts the next one
+func (s *shipment) rotate() error {
+	if s.shard > 0 {
+		if err := s.tmpl.ExecuteTemplate(s.dest, "aft", s.meta); err != nil {
+			return err
+		}
+		err := s.dest.Close()
+		s.dest = nil
+		if err != nil {
+			return err
+		}
+	}
+	s.shard++
+	dest, err := s.create(shardname(s.destfile, s.shard))
+	s.dest = dest
+	if err != nil {
 		return err
 	}
-	// create output file
-	dest, err := os.Create(destfile)
+	s.wo, s.left = contents(dest), s.meta.ShardSize
+	return s.tmpl.ExecuteTemplate(dest, "shardFore", s.meta)
+}
+
+// ship ships the file of the given entry to the current go file, it might be
+// split into chunks across several shards if it is too large
+func (s *shipment) ship(e entry, buf []byte) error {
+	if e.Ref != "" {
+		if e.Sharded && s.shard == 0 {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+		return s.tmpl.ExecuteTemplate(s.dest, "ref", e)
+	}
+
+	// open file
+	f, size, err := e.open()
 	if err != nil {
 		return err
 	}
-	defer dest.Close()
-	wo := &w{dest}
+	defer f.Close()
 
-	fore.Execute(dest, meta)
+	if s.asm != nil {
+		e.Symbol = fmt.Sprintf("_%s_%d", e.VarName, len(s.symbols))
+		// write entry
+		if err := s.tmpl.ExecuteTemplate(s.dest, "entryStart", e); err != nil {
+			return err
+		}
+		a := &as{f: s.asm, symbol: e.Symbol}
+		if err := pack(a, f, e.Gziped, buf); err != nil {
+			return err
+		}
+		if err := a.Close(); err != nil {
+			return err
+		}
+		s.symbols = append(s.symbols, symbol{e.Symbol, a.off})
+		return s.tmpl.ExecuteTemplate(s.dest, "entryEnd", e)
+	}
 
-	buf := make([]byte, 1048576)
-	traverse(meta.Dir, "", func(root string, dir string, filename string) {
-		for _, include := range meta.Includes {
-			// check file path
-			fullpath := filepath.Join(root, dir, filename)
-			if !include.Wc.Search([]rune(fullpath), true).AllMatching() {
-				continue
-			}
-			// open file
-			f, err := os.Open(fullpath)
-			if err != nil {
-				continue
-			}
-			defer f.Close()
-			// write entry
-			for {
-				if n, err := f.Read(buf); err == io.EOF {
-					break
-				} else if err != nil {
-					break
-				} else {
-					entryStart.Execute(dest, Include{Filename: path.Join(dir, filename), Gziped: include.Gziped})
-					if include.Gziped {
-						Gzip(wo, buf[:n])
-					} else {
-						wo.Write(buf[:n])
-					}
-					entryEnd.Execute(dest, nil)
-				}
-			}
+	if !e.Sharded {
+		// write entry
+		if err := s.tmpl.ExecuteTemplate(s.dest, "entryStart", e); err != nil {
+			return err
 		}
-	})
+		if err := pack(s.wo, f, e.Gziped, buf); err != nil {
+			return err
+		}
+		return s.tmpl.ExecuteTemplate(s.dest, "entryEnd", e)
+	}
 
-	aft.Execute(dest, nil)
-	return nil
+	// the size of the contents must be known before sharding
+	var contents io.Reader = f
+	if e.Gziped {
+		var b bytes.Buffer
+		if err := pack(&b, f, true, buf); err != nil {
+			return err
+		}
+		contents, size = &b, int64(b.Len())
+	}
+
+	// start a new shard rather than chunking the contents if they fit in one
+	if size > s.left && size <= s.meta.ShardSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	e.Chunked = size > s.left
+	for e.Chunk = 0; ; e.Chunk++ {
+		if s.left == 0 {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+		n := size
+		if n > s.left {
+			n = s.left
+		}
+		// write entry or chunk
+		if err := s.tmpl.ExecuteTemplate(s.dest, "entryStart", e); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(s.wo, contents, n); err != nil {
+			return err
+		}
+		if err := s.tmpl.ExecuteTemplate(s.dest, "entryEnd", e); err != nil {
+			return err
+		}
+		size, s.left = size-n, s.left-n
+		if size == 0 {
+			return nil
+		}
+	}
 }
@@ -0,0 +1,1272 @@
+package shipper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const prober = `package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"strings"
+)
+
+func main() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	// the resident set size in pages, only available on linux
+	statm, _ := ioutil.ReadFile("/proc/self/statm")
+	rss := append(strings.Fields(string(statm)), "0", "0")[1]
+	fmt.Println(len(*A), m.HeapAlloc, rss)
+}
+`
+
+// random writes files of random bytes of the given sizes to a temporary
+// directory, and returns the directory
+func random(tb testing.TB, sizes ...int) string {
+	dir, err := ioutil.TempDir("", "shipper")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for i, size := range sizes {
+		data := make([]byte, size)
+		rand.Read(data)
+		ioutil.WriteFile(filepath.Join(dir, strconv.Itoa(i)), data, 0644)
+	}
+	return dir
+}
+
+// build ships the given meta along with the given main go file, and builds
+// them into an executable in a temporary directory with the given environment
+func build(tb testing.TB, meta Meta, main string, env ...string) string {
+	// the package must live in this module to import the shipper package
+	os.MkdirAll("testdata", 0755)
+	pkg, err := ioutil.TempDir("testdata", "pkg")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer os.Remove("testdata")
+	defer os.RemoveAll(pkg)
+
+	if err := Ship(meta, filepath.Join(pkg, "assets.go")); err != nil {
+		tb.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(pkg, "main.go"), []byte(main), 0644)
+
+	tmp, err := ioutil.TempDir("", "shipper")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	exe := filepath.Join(tmp, "main")
+	cmd := exec.Command("go", "build", "-o", exe, "./"+pkg)
+	cmd.Env = append(os.Environ(), env...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		tb.Fatalf("%v: %s", err, out)
+	}
+	return exe
+}
+
+func benchmarkInit(b *testing.B, stringed bool) {
+	src := random(b, 1<<20, 1<<20, 1<<20, 1<<20, 1<<20, 1<<20, 1<<20, 1<<20)
+	defer os.RemoveAll(src)
+
+	meta := Meta{Package: "main", VarName: "A", Dir: src, Stringed: stringed}
+	meta.Including("*", false)
+	exe := build(b, meta, prober)
+	defer os.RemoveAll(filepath.Dir(exe))
+
+	b.ResetTimer()
+	var heap, rss uint64
+	for i := 0; i < b.N; i++ {
+		out, err := exec.Command(exe).Output()
+		if err != nil {
+			b.Fatal(err)
+		}
+		fields := strings.Fields(string(out))
+		n, _ := strconv.ParseUint(fields[1], 10, 64)
+		heap += n
+		n, _ = strconv.ParseUint(fields[2], 10, 64)
+		rss += n * uint64(os.Getpagesize())
+	}
+	b.ReportMetric(float64(heap)/float64(b.N), "heap-B/op")
+	b.ReportMetric(float64(rss)/float64(b.N), "rss-B/op")
+}
+
+func BenchmarkInitBytes(b *testing.B) {
+	benchmarkInit(b, false)
+}
+
+func BenchmarkInitStringed(b *testing.B) {
+	benchmarkInit(b, true)
+}
+
+func TestTable(t *testing.T) {
+	table := &Table{
+		{Name: "a", Content: Content{Str: "a"}},
+		{Name: "a.b", Content: Content{Str: "a.b"}},
+		{Name: "a/b", Content: Content{Bytes: []byte("a/b")}},
+	}
+	for _, name := range table.Names() {
+		content, ok := table.Get(name)
+		if !ok {
+			t.Errorf("%s should be found", name)
+			continue
+		}
+		if data, _ := content.Data(); string(data) != name {
+			t.Errorf("%s is mapped to the wrong content %s", name, data)
+		}
+	}
+	if _, ok := table.Get("b"); ok {
+		t.Error("b should not be found")
+	}
+}
+
+const restorer = `package main
+
+import (
+	"os"
+)
+
+func main() {
+	for _, name := range A.Names() {
+		if err := A.RestoreAs(name, os.Args[1]+"/"+name); err != nil {
+			panic(err)
+		}
+	}
+}
+`
+
+// roundtrip ships the given meta, restores all of the contents by an
+// executable and checks if they are identical with the origin files
+func roundtrip(t *testing.T, meta Meta) {
+	exe := build(t, meta, restorer)
+	defer os.RemoveAll(filepath.Dir(exe))
+	verify(t, exe, meta.Dir)
+}
+
+// verify runs the built restorer and checks if the restored files are
+// identical with the ones in the given directory
+func verify(t *testing.T, exe string, dir string) {
+	dest := filepath.Join(filepath.Dir(exe), "restored")
+	if out, err := exec.Command(exe, dest).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	fis, _ := ioutil.ReadDir(dir)
+	for _, fi := range fis {
+		origin, _ := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+		restored, err := ioutil.ReadFile(filepath.Join(dest, fi.Name()))
+		if err != nil || string(origin) != string(restored) {
+			t.Errorf("%s is not correctly restored", fi.Name())
+		}
+	}
+}
+
+// metas returns the metas including the given files of both the assets and
+// the table layout, in which the last few files are gziped
+func metas(dir string, gziped int) []Meta {
+	var ms []Meta
+	fis, _ := ioutil.ReadDir(dir)
+	for _, table := range []bool{false, true} {
+		meta := Meta{Package: "main", VarName: "A", Dir: dir, Table: table}
+		for i, fi := range fis {
+			meta.Including(fi.Name(), i >= len(fis)-gziped)
+		}
+		ms = append(ms, meta)
+	}
+	return ms
+}
+
+func TestShard(t *testing.T) {
+	src := random(t, 0, 100, 1000, 4000, 10000)
+	defer os.RemoveAll(src)
+
+	for _, meta := range metas(src, 2) {
+		meta.ShardSize = 3000
+		roundtrip(t, meta)
+	}
+}
+
+func TestAsm(t *testing.T) {
+	src := random(t, 0, 1, 8, 9, 1000, 10000)
+	defer os.RemoveAll(src)
+
+	for _, meta := range metas(src, 2) {
+		roundtrip(t, meta)
+		meta.Asm = true
+		roundtrip(t, meta)
+		for _, arch := range []string{"amd64", "arm64"} {
+			exe := build(t, meta, restorer, "GOOS=linux", "GOARCH="+arch)
+			os.RemoveAll(filepath.Dir(exe))
+		}
+	}
+}
+
+func TestAppend(t *testing.T) {
+	src := random(t, 0, 100, 10000)
+	defer os.RemoveAll(src)
+	data, _ := ioutil.ReadFile(filepath.Join(src, "2"))
+	ioutil.WriteFile(filepath.Join(src, "3"), data, 0644)
+
+	meta := metas(src, 1)[0]
+	meta.Appended = true
+	exe := build(t, meta, restorer)
+	defer os.RemoveAll(filepath.Dir(exe))
+	// appending again replaces the previously appended archive
+	for i := 0; i < 2; i++ {
+		if err := Append(meta, exe); err != nil {
+			t.Fatal(err)
+		}
+	}
+	verify(t, exe, src)
+
+	// a failed appending leaves the executable as it is
+	before, _ := ioutil.ReadFile(exe)
+	fsys := &flaky{FS: os.DirFS(src), left: 2}
+	if err := NewBundle(meta).AddFS(fsys, Options{}, "1").Append(exe); err == nil {
+		t.Fatal("should fail to append")
+	}
+	if after, _ := ioutil.ReadFile(exe); !bytes.Equal(before, after) {
+		t.Error("the executable should be left untouched")
+	}
+	if temps, _ := filepath.Glob(filepath.Join(filepath.Dir(exe), ".*.tmp")); len(temps) != 0 {
+		t.Errorf("the temporary files should be removed yet got %v", temps)
+	}
+}
+
+func TestReship(t *testing.T) {
+	src := random(t, 1000, 4000, 10000)
+	defer os.RemoveAll(src)
+	meta := metas(src, 0)[0]
+	meta.ShardSize = 3000
+	dir := t.TempDir()
+	destfile := filepath.Join(dir, "assets.go")
+	if err := Ship(meta, destfile); err != nil {
+		t.Fatal(err)
+	}
+	shards, _ := filepath.Glob(filepath.Join(dir, "assets_*.go"))
+
+	// the stale shards are kept unless everything is replaced
+	os.Remove(destfile)
+	os.MkdirAll(filepath.Join(destfile, "busy"), 0755)
+	meta.ShardSize = 100000
+	if err := Ship(meta, destfile); err == nil {
+		t.Fatal("should fail to replace the directory")
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "assets_*.go")); len(left) != len(shards) {
+		t.Errorf("the shards %v should be kept yet got %v", shards, left)
+	}
+	if temps, _ := filepath.Glob(filepath.Join(dir, ".*.tmp")); len(temps) != 0 {
+		t.Errorf("the temporary files should be removed yet got %v", temps)
+	}
+
+	os.RemoveAll(destfile)
+	if err := Ship(meta, destfile); err != nil {
+		t.Fatal(err)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "assets_*.go")); len(left) != 1 || len(shards) < 2 {
+		t.Errorf("only one of the shards %v should be left yet got %v", shards, left)
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	src := t.TempDir()
+	os.Mkdir(filepath.Join(src, "d"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "a"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "d", "x"), []byte("x"), 0644)
+	os.Symlink("a", filepath.Join(src, "b"))
+	os.Symlink("d", filepath.Join(src, "e"))
+	meta := Meta{Dir: src}
+	meta.Including("*", false)
+	entries, err := NewBundle(meta).AddIncluded().gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Filename)
+	}
+	// the symlinked directory is skipped rather than failing to be read
+	if !reflect.DeepEqual(names, []string{"a", "b", "d/x"}) {
+		t.Errorf("should ship a, b and d/x yet got %v", names)
+	}
+
+	os.Symlink("nothing", filepath.Join(src, "f"))
+	if _, err := NewBundle(meta).AddIncluded().gather(); err == nil {
+		t.Error("the broken symlink should fail to be read")
+	}
+}
+
+func TestCorrupted(t *testing.T) {
+	for _, sizes := range [][2]uint64{{1<<64 - 4, 50}, {0, 1<<64 - 1}, {0, 10}, {100, 50}, {0, 1000}} {
+		data := make([]byte, 100)
+		binary.LittleEndian.PutUint64(data[76:], sizes[0])
+		binary.LittleEndian.PutUint64(data[84:], sizes[1])
+		copy(data[92:], magic)
+		if _, _, err := appended(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Errorf("the trailer of the sizes %v should be corrupted", sizes)
+		}
+	}
+}
+
+// flaky fails to open any file once the given times of opening are used up
+type flaky struct {
+	fs.FS
+	left int
+}
+
+func (f *flaky) Open(name string) (fs.File, error) {
+	if name != "." {
+		if f.left == 0 {
+			return nil, errors.New("flaky")
+		}
+		f.left--
+	}
+	return f.FS.Open(name)
+}
+
+func TestDedup(t *testing.T) {
+	src := random(t, 100, 10000)
+	defer os.RemoveAll(src)
+	data, _ := ioutil.ReadFile(filepath.Join(src, "1"))
+	ioutil.WriteFile(filepath.Join(src, "2"), data, 0644)
+
+	for _, meta := range metas(src, 1) {
+		// the files matching several includes must be shipped only once
+		meta.Including("*", true)
+		roundtrip(t, meta)
+		meta.Asm = true
+		roundtrip(t, meta)
+		meta.Asm, meta.ShardSize = false, 3000
+		roundtrip(t, meta)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dest, _ := ioutil.TempDir("", "shipper")
+	defer os.RemoveAll(dest)
+	destfile := filepath.Join(dest, "assets.go")
+
+	for _, variant := range []Meta{{}, {ShardSize: 3000}, {Asm: true}} {
+		src := random(t, 100, 100, 10000)
+		defer os.RemoveAll(src)
+
+		for _, meta := range metas(src, 0) {
+			meta.ShardSize, meta.Asm = variant.ShardSize, variant.Asm
+			if err := Ship(meta, destfile); err != nil {
+				t.Fatal(err)
+			}
+			if err := Check(meta, destfile); err != nil {
+				t.Errorf("should be up to date yet got %v", err)
+			}
+		}
+
+		ioutil.WriteFile(filepath.Join(src, "0"), []byte("changed"), 0644)
+		ioutil.WriteFile(filepath.Join(src, "3"), []byte("added"), 0644)
+		os.Remove(filepath.Join(src, "1"))
+		for _, meta := range metas(src, 0)[1:] {
+			meta.ShardSize, meta.Asm = variant.ShardSize, variant.Asm
+			err := Check(meta, destfile)
+			if d, ok := err.(*Difference); !ok ||
+				len(d.Added) != 1 || len(d.Removed) != 1 || len(d.Changed) != 1 {
+				t.Errorf("should differ by 1 added, 1 removed and 1 changed yet got %v", err)
+			}
+		}
+	}
+}
+
+func TestReproducible(t *testing.T) {
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+
+	// lay the same tree in different orders at different times and places
+	var roots []string
+	for i, order := range [][]string{{"b/c", "a", "b/a.b"}, {"b/a.b", "a", "b/c"}} {
+		root, _ := ioutil.TempDir("", "shipper")
+		defer os.RemoveAll(root)
+		for _, name := range order {
+			file := filepath.Join(root, "tree", filepath.FromSlash(name))
+			os.MkdirAll(filepath.Dir(file), 0755)
+			ioutil.WriteFile(file, []byte(strings.Repeat(name, 10)), 0644)
+			mtime := time.Now().Add(time.Duration(i) * time.Hour)
+			os.Chtimes(file, mtime, mtime)
+		}
+		roots = append(roots, root)
+	}
+
+	for _, variant := range []Meta{{}, {Table: true, Stringed: true}, {ShardSize: 10}, {Asm: true}} {
+		var shipped []map[string]string
+		for _, root := range roots {
+			// ship the relative tree from each of the places
+			os.Chdir(root)
+			meta := variant
+			meta.Package, meta.VarName, meta.Dir = "main", "A", "tree"
+			meta.Including("a", false)
+			meta.Including("b/*", true)
+			if err := Ship(meta, filepath.Join("out", "assets.go")); err != nil {
+				t.Fatal(err)
+			}
+			files := map[string]string{}
+			fis, _ := ioutil.ReadDir("out")
+			for _, fi := range fis {
+				data, _ := ioutil.ReadFile(filepath.Join("out", fi.Name()))
+				files[fi.Name()] = string(data)
+			}
+			shipped = append(shipped, files)
+		}
+		if len(shipped[0]) == 0 || !reflect.DeepEqual(shipped[0], shipped[1]) {
+			t.Errorf("%+v should be shipped identically yet got %v and %v", variant, shipped[0], shipped[1])
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	src := random(t, 100, 100, 1000)
+	defer os.RemoveAll(src)
+	data, _ := ioutil.ReadFile(filepath.Join(src, "0"))
+	ioutil.WriteFile(filepath.Join(src, "3"), data, 0644)
+
+	meta := Meta{Dir: src}
+	meta.Including("0", false)
+	meta.Including("2", true)
+	meta.Including("?", false)
+	meta.Including("1", true)
+	listings, err := List(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, should := range []Listing{
+		{Path: "0", Key: "0", Include: "0", Size: 100, Shipped: 100},
+		{Path: "1", Key: "1", Include: "?", Size: 100, Shipped: 100},
+		{Path: "2", Key: "2", Include: "2", Gziped: true, Size: 1000, Shipped: listings[2].Shipped},
+		{Path: "3", Key: "3", Include: "?", Size: 100, Ref: "0"},
+	} {
+		if listings[i] != should {
+			t.Errorf("expecting %+v yet got %+v", should, listings[i])
+		}
+	}
+	if listings[2].Shipped <= 1000 {
+		t.Errorf("random bytes should not shrink when gziped yet got %d", listings[2].Shipped)
+	}
+
+	// a.txt is traversed after a/x yet shipped before it
+	src = t.TempDir()
+	os.Mkdir(filepath.Join(src, "a"), 0755)
+	ioutil.WriteFile(filepath.Join(src, "a.txt"), data, 0644)
+	ioutil.WriteFile(filepath.Join(src, "a", "x"), data, 0644)
+	meta = Meta{Dir: src}
+	meta.Including("*", false)
+	if listings, err = List(meta); err != nil {
+		t.Fatal(err)
+	}
+	if listings[0].Ref != "" || listings[1].Ref != "a.txt" {
+		t.Errorf("a/x should refer to a.txt as shipped yet got %+v", listings)
+	}
+}
+
+func TestFailure(t *testing.T) {
+	src := random(t, 100)
+	defer os.RemoveAll(src)
+	// a dangling link could be visited yet not read
+	os.Symlink(filepath.Join(src, "nowhere"), filepath.Join(src, "1"))
+	dest, _ := ioutil.TempDir("", "shipper")
+	defer os.RemoveAll(dest)
+	destfile := filepath.Join(dest, "assets.go")
+	ioutil.WriteFile(destfile, []byte("untouched"), 0644)
+
+	meta := metas(src, 0)[0]
+	if err := Ship(meta, destfile); err == nil {
+		t.Error("should fail on the dangling link")
+	}
+	if fis, _ := ioutil.ReadDir(dest); len(fis) != 1 {
+		t.Errorf("the temporary files should be removed yet got %d files", len(fis))
+	}
+	if data, _ := ioutil.ReadFile(destfile); string(data) != "untouched" {
+		t.Error("the destfile should be untouched on failure")
+	}
+
+	var warnings []error
+	meta.Lenient, meta.Warn = true, func(err error) { warnings = append(warnings, err) }
+	if err := Ship(meta, destfile); err != nil {
+		t.Error(err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("should warn about the dangling link yet got %v", warnings)
+	}
+	if err := Check(meta, destfile); err != nil {
+		t.Errorf("should be up to date without the dangling link yet got %v", err)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	src := random(t, 100, 10000, 1000)
+	defer os.RemoveAll(src)
+
+	for _, meta := range metas(src, 1) {
+		// the files from various sources are shipped as if they were included
+		data, _ := ioutil.ReadFile(filepath.Join(src, "2"))
+		bundle := NewBundle(meta).
+			AddFS(os.DirFS(src), Options{}, "0", "1").
+			AddFile("2", bytes.NewReader(data), Options{Gziped: true})
+		var b bytes.Buffer
+		if _, err := bundle.WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+		dest := filepath.Join(t.TempDir(), "assets.go")
+		if err := Ship(meta, dest); err != nil {
+			t.Fatal(err)
+		}
+		if shipped, _ := ioutil.ReadFile(dest); string(shipped) != b.String() {
+			t.Errorf("the bundle should be shipped as %s yet got %s", shipped, b.String())
+		}
+
+		if _, err := bundle.AddFile("0", strings.NewReader(""), Options{}).WriteTo(ioutil.Discard); err == nil {
+			t.Error("the duplicate file should fail the bundle")
+		}
+		meta.ShardSize = 1000
+		if _, err := NewBundle(meta).WriteTo(ioutil.Discard); err == nil {
+			t.Error("the sharding should fail writing to a writer")
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	src := random(t)
+	defer os.RemoveAll(src)
+	for _, name := range []string{`a"b.txt`, `c\d`, "e\nf", "`g`"} {
+		ioutil.WriteFile(filepath.Join(src, name), []byte(name), 0644)
+	}
+	for _, meta := range metas(src, 1) {
+		roundtrip(t, meta)
+		meta.ShardSize = 5
+		roundtrip(t, meta)
+	}
+
+	meta := metas(src, 0)[0]
+	for _, invalid := range []Meta{{Package: "a-b"}, {Package: "func"}, {VarName: "_a"}, {VarName: "1a"}, {Tags: "a\nb"}} {
+		if invalid.Package == "" {
+			invalid.Package = meta.Package
+		}
+		if invalid.VarName == "" {
+			invalid.VarName = meta.VarName
+		}
+		invalid.Dir, invalid.Includes = meta.Dir, meta.Includes
+		if err := Ship(invalid, filepath.Join(t.TempDir(), "assets.go")); err == nil {
+			t.Errorf("%+v should fail", invalid)
+		}
+	}
+}
+
+const custom = `{{define "fore"}}// Licensed under the MIT License.
+
+{{template "header" .}}
+// {{cap .VarName}} is the Asset
+var {{cap .VarName}} = &shipper.Assets{
+{{end}}
+{{define "entryStart"}}
+	// {{.Size}} bytes {{.Codec}} {{.Hash}}
+	{{quote .Filename}}: shipper.Content{Gziped: {{.Gziped}}, Bytes: []byte("{{end}}
+{{define "entryEnd"}}")},{{end}}
+{{define "ref"}}
+	// the same as {{.Ref}}
+	{{quote .Filename}}: shipper.Content{Ref: {{quote .Ref}}},{{end}}
+{{define "aft"}}
+}
+
+// Hello says hello from {{.Package}}
+func Hello() string { return "hello from {{.Package}}" }{{end}}`
+
+func TestTemplate(t *testing.T) {
+	src := random(t, 100, 10000)
+	defer os.RemoveAll(src)
+	data, _ := ioutil.ReadFile(filepath.Join(src, "1"))
+	ioutil.WriteFile(filepath.Join(src, "2"), data, 0644)
+	tmp := t.TempDir()
+	tmpl := filepath.Join(tmp, "custom.tmpl")
+	ioutil.WriteFile(tmpl, []byte(custom), 0644)
+
+	meta := metas(src, 2)[0]
+	meta.Template = tmpl
+	roundtrip(t, meta)
+
+	destfile := filepath.Join(tmp, "assets.go")
+	if err := Ship(meta, destfile); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	shipped, _ := ioutil.ReadFile(destfile)
+	for _, want := range []string{"// Licensed under", "// 10000 bytes gzip " + hex.EncodeToString(sum[:]), "// the same as 1",
+		"func Hello()"} {
+		if !strings.Contains(string(shipped), want) {
+			t.Errorf("the shipped file should contain %q", want)
+		}
+	}
+
+	ioutil.WriteFile(tmpl, []byte(`{{define "fore"}}{{.Nothing}}{{end}}`), 0644)
+	if err := Ship(meta, destfile); err == nil {
+		t.Error("the invalid template should fail")
+	}
+}
+
+func TestStandalone(t *testing.T) {
+	src := random(t, 100, 10000, 10000)
+	defer os.RemoveAll(src)
+
+	for _, meta := range metas(src, 1) {
+		meta.Standalone = true
+		roundtrip(t, meta)
+		meta.Stringed, meta.ShardSize = true, 3000
+		roundtrip(t, meta)
+		meta.Stringed, meta.ShardSize, meta.Asm = false, 0, true
+		roundtrip(t, meta)
+
+		destfile := filepath.Join(t.TempDir(), "assets.go")
+		if err := Ship(meta, destfile); err != nil {
+			t.Fatal(err)
+		}
+		if shipped, _ := ioutil.ReadFile(destfile); strings.Contains(string(shipped), "sinloss/shipper") {
+			t.Error("the standalone file should not import the shipper package")
+		}
+		if err := Check(meta, destfile); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	src := random(t, 100, 10000)
+	defer os.RemoveAll(src)
+
+	for tags, lines := range map[string]string{
+		"linux && (amd64 || arm64)": "//go:build linux && (amd64 || arm64)\n// +build linux\n// +build amd64 arm64\n",
+		"linux,amd64 !darwin":       "//go:build (linux && amd64) || !darwin\n// +build linux,amd64 !darwin\n",
+	} {
+		meta := metas(src, 1)[0]
+		meta.Tags, meta.Asm = tags, true
+		destfile := filepath.Join(t.TempDir(), "assets.go")
+		if err := Ship(meta, destfile); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{destfile, asmname(destfile)} {
+			if shipped, _ := ioutil.ReadFile(name); !strings.Contains(string(shipped), lines) {
+				t.Errorf("%s should be constrained by %q yet got %s", name, lines, shipped)
+			}
+		}
+	}
+
+	meta := metas(src, 1)[0]
+	meta.Tags = "shipper || !shipper"
+	roundtrip(t, meta)
+	for _, invalid := range []string{"linux &&", "linux amd64 &&", "(linux", "linux\ndarwin"} {
+		meta.Tags = invalid
+		if err := Ship(meta, filepath.Join(t.TempDir(), "assets.go")); err == nil {
+			t.Errorf("%q should fail", invalid)
+		}
+	}
+}
+
+const platformer = `package main
+
+import (
+	"os"
+)
+
+func main() {
+	if err := A.ForPlatform().RestoreAs("lib/libfoo.so", os.Args[1]); err != nil {
+		panic(err)
+	}
+}`
+
+func TestPlatform(t *testing.T) {
+	src := t.TempDir()
+	here := runtime.GOOS + "_" + runtime.GOARCH
+	for _, dir := range []string{here, "plan9_386"} {
+		os.MkdirAll(filepath.Join(src, dir, "lib"), 0755)
+		ioutil.WriteFile(filepath.Join(src, dir, "lib", "libfoo.so"), []byte(dir), 0644)
+	}
+	meta := Meta{Package: "main", VarName: "A", Dir: src}
+	meta.Including("*", false)
+	exe := build(t, meta, platformer)
+	defer os.RemoveAll(filepath.Dir(exe))
+	dest := filepath.Join(filepath.Dir(exe), "libfoo.so")
+	if out, err := exec.Command(exe, dest).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if data, _ := ioutil.ReadFile(dest); string(data) != here {
+		t.Errorf("the library for %s should be restored yet got %s", here, data)
+	}
+
+	table := &Table{
+		{Name: "linux_arm64/a", Content: Content{Str: "a"}},
+		{Name: "linux_arm64/b/c", Content: Content{Str: "c"}},
+		{Name: "linux_arm64x/d", Content: Content{Str: "d"}},
+	}
+	view := platform(table, "linux", "arm64")
+	if names := view.Names(); !reflect.DeepEqual(names, []string{"a", "b/c"}) {
+		t.Errorf("should view a and b/c yet got %v", names)
+	}
+	if _, ok := view.Get("d"); ok {
+		t.Error("d should not be viewed")
+	}
+}
+
+const librarian = `package main
+
+import (
+	"os"
+)
+
+func main() {
+	if err := os.Chdir(os.Args[1]); err != nil {
+		panic(err)
+	}
+	if err := A.Restore(A.Names()...); err != nil {
+		panic(err)
+	}
+}`
+
+func TestShared(t *testing.T) {
+	gcc, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Skip("gcc is needed to build the shared libraries")
+	}
+	src := t.TempDir()
+	ioutil.WriteFile(filepath.Join(src, "bar.c"), []byte("int bar(void) { return 1; }\n"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "foo.c"), []byte("int bar(void);\nint foo(void) { return bar(); }\n"), 0644)
+	for _, args := range [][]string{
+		{"-shared", "-fPIC", "-Wl,-soname,libbar.so.1", "-o", "libbar.so.1.0", "bar.c"},
+		{"-shared", "-fPIC", "-Wl,-soname,libfoo.so.1", "-o", "libfoo.so.1.2.3", "foo.c", "-L.", "-l:libbar.so.1.0"},
+	} {
+		cmd := exec.Command(gcc, args...)
+		cmd.Dir = src
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("could not build the shared libraries: %v: %s", err, out)
+		}
+	}
+
+	meta := Meta{Package: "main", VarName: "A", Dir: src}
+	meta.Including("*.so.*", true)
+	destfile := filepath.Join(t.TempDir(), "assets.go")
+	if err := Ship(meta, destfile); err != nil {
+		t.Fatal(err)
+	}
+	shipped, _ := ioutil.ReadFile(destfile)
+	// regardless of the alignment
+	fields := strings.Join(strings.Fields(string(shipped)), " ")
+	if !strings.Contains(fields, `Needed: []string{"libbar.so.1"}`) || !strings.Contains(fields, `Soname: "libfoo.so.1"`) {
+		t.Error("the SONAME and the DT_NEEDED entries should be shipped")
+	}
+
+	exe := build(t, meta, librarian)
+	defer os.RemoveAll(filepath.Dir(exe))
+	dest := filepath.Join(filepath.Dir(exe), "restored")
+	os.MkdirAll(dest, 0755)
+	if out, err := exec.Command(exe, dest).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	for name, target := range map[string]string{
+		"libbar.so.1": "libbar.so.1.0", "libbar.so": "libbar.so.1",
+		"libfoo.so.1": "libfoo.so.1.2.3", "libfoo.so": "libfoo.so.1",
+	} {
+		if got, err := os.Readlink(filepath.Join(dest, name)); err != nil || got != target {
+			t.Errorf("%s should link to %s yet got %s %v", name, target, got, err)
+		}
+	}
+
+	table := &Table{
+		{Name: "a", Content: Content{Soname: "liba.so", Needed: []string{"libb.so", "libc.so.6"}}},
+		{Name: "b", Content: Content{Soname: "libb.so"}},
+		{Name: "c"},
+	}
+	if order := ordered(table, []string{"c", "a", "b"}); !reflect.DeepEqual(order, []string{"c", "b", "a"}) {
+		t.Errorf("the libraries should be restored after the ones they need yet got %v", order)
+	}
+}
+
+func TestMachine(t *testing.T) {
+	want, ok := machines[runtime.GOARCH]
+	if !ok {
+		t.Skipf("%s is not an ELF architecture", runtime.GOARCH)
+	}
+	src := t.TempDir()
+	exe := filepath.Join(src, "shipper")
+	if out, err := exec.Command("go", "build", "-o", exe, "github.com/sinloss/shipper").CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	meta := Meta{Package: "main", VarName: "A", Dir: src}
+	meta.Including("*", false)
+	entries, err := NewBundle(meta).AddIncluded().gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := [3]string{entries[0].Machine, entries[0].Class, entries[0].Order}; runtime.GOOS == "linux" && got != want {
+		t.Errorf("the executable should be recorded as %v yet got %v", want, got)
+	}
+
+	other := "EM_S390"
+	if want[0] == other {
+		other = "EM_X86_64"
+	}
+	reversed := "ELFDATA2MSB"
+	if want[2] == reversed {
+		reversed = "ELFDATA2LSB"
+	}
+	dest := t.TempDir()
+	table := &Table{
+		{Name: "foreign", Content: Content{Str: "foreign", Machine: other, Class: "ELFCLASS64"}},
+		{Name: "native", Content: Content{Str: "native", Machine: want[0], Class: want[1], Order: want[2]}},
+		{Name: "plain", Content: Content{Str: "plain"}},
+		{Name: "reversed", Content: Content{Str: "reversed", Machine: want[0], Class: want[1], Order: reversed}},
+	}
+	for _, name := range []string{"native", "plain"} {
+		if err := table.RestoreAs(name, filepath.Join(dest, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, name := range []string{"foreign", "reversed"} {
+		err = table.RestoreAs(name, filepath.Join(dest, name))
+		if err == nil || !strings.Contains(err.Error(), runtime.GOARCH) {
+			t.Errorf("the %s binary should fail to be restored yet got %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dest, name)); err == nil {
+			t.Errorf("nothing should be restored for the %s binary", name)
+		}
+		if err := RestoreAsAnyArch(table, name, filepath.Join(dest, name)); err != nil {
+			t.Errorf("the %s binary should be restored for any architecture yet got %v", name, err)
+		}
+	}
+}
+
+// setenv sets the environment variable until the test ends
+func setenv(tb testing.TB, key string, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	tb.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestLibraries(t *testing.T) {
+	table := &Table{
+		{Name: "lib/libbar.so.1", Content: Content{Str: "bar", Soname: "libbar.so.1"}},
+		{Name: "lib/libfoo.so", Content: Content{Str: "foo", Needed: []string{"libbar.so.1"}}},
+	}
+	for _, old := range []string{"", "/opt/lib"} {
+		setenv(t, "LD_LIBRARY_PATH", old)
+		env, cleanup, err := Libraries(table, "lib/libfoo.so", "lib/libbar.so.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, kv := range env {
+			if strings.HasPrefix(kv, "LD_LIBRARY_PATH=") {
+				paths = append(paths, strings.TrimPrefix(kv, "LD_LIBRARY_PATH="))
+			}
+		}
+		if len(paths) != 1 {
+			t.Fatalf("LD_LIBRARY_PATH should be set once yet got %v", paths)
+		}
+		dirs := filepath.SplitList(paths[0])
+		if old != "" && (len(dirs) != 2 || dirs[1] != old) {
+			t.Errorf("the directory should be prepended to %s yet got %s", old, paths[0])
+		}
+		for name, data := range map[string]string{"libfoo.so": "foo", "libbar.so.1": "bar", "libbar.so": "bar"} {
+			if restored, _ := ioutil.ReadFile(filepath.Join(dirs[0], name)); string(restored) != data {
+				t.Errorf("%s should be restored as %s yet got %s", name, data, restored)
+			}
+		}
+		if err := cleanup(); err != nil {
+			t.Error(err)
+		}
+		if err := cleanup(); err != nil {
+			t.Error(err)
+		}
+		if _, err := os.Stat(dirs[0]); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed", dirs[0])
+		}
+	}
+
+	table = &Table{
+		{Name: "a/libfoo.so", Content: Content{Str: "a"}},
+		{Name: "b/libfoo.so", Content: Content{Str: "b"}},
+	}
+	if _, _, err := Libraries(table, table.Names()...); err == nil {
+		t.Error("the libraries of the same base name should collide")
+	}
+}
+
+const hello = `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Print("hello ", os.Args[1])
+}`
+
+func TestCommand(t *testing.T) {
+	src := t.TempDir()
+	ioutil.WriteFile(filepath.Join(src, "hello.go"), []byte(hello), 0644)
+	exe := filepath.Join(src, "hello")
+	if out, err := exec.Command("go", "build", "-o", exe, filepath.Join(src, "hello.go")).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	data, _ := ioutil.ReadFile(exe)
+	assets := &Assets{"bin/hello": Content{Bytes: data}}
+	// extract to the cache of this test only
+	setenv(t, "XDG_CACHE_HOME", t.TempDir())
+
+	var paths []string
+	var mtimes []time.Time
+	for _, arg := range []string{"world", "again"} {
+		cmd, err := Command(assets, "bin/hello", arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, err := cmd.Output(); err != nil || string(out) != "hello "+arg {
+			t.Errorf("should say hello %s yet got %s %v", arg, out, err)
+		}
+		stat, _ := os.Stat(cmd.Path)
+		paths, mtimes = append(paths, cmd.Path), append(mtimes, stat.ModTime())
+	}
+	if paths[0] != paths[1] || !mtimes[0].Equal(mtimes[1]) {
+		t.Errorf("the unchanged executable should be reused yet got %v", paths)
+	}
+
+	(*assets)["bin/hello"] = Content{Bytes: append(data, 0)}
+	cmd, err := Command(assets, "bin/hello", "changed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Path == paths[0] {
+		t.Error("the changed executable should be extracted anew")
+	}
+	if _, err := Command(assets, "bin/nothing"); err == nil {
+		t.Error("should fail to find the executable")
+	}
+
+	// nothing is written to the disk
+	os.RemoveAll(os.Getenv("XDG_CACHE_HOME"))
+	for _, arg := range []string{"memfd", "again"} {
+		cmd, err := MemCommand(assets, "bin/hello", arg)
+		if runtime.GOOS != "linux" {
+			if err == nil {
+				t.Error("should fail without memfd_create")
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, err := cmd.Output(); err != nil || string(out) != "hello "+arg {
+			t.Errorf("should say hello %s yet got %s %v", arg, out, err)
+		}
+	}
+	if _, err := os.Stat(os.Getenv("XDG_CACHE_HOME")); !os.IsNotExist(err) {
+		t.Error("the diskless executable should not be extracted")
+	}
+}
+
+func TestRestoreTemp(t *testing.T) {
+	assets := &Assets{
+		"a":   Content{Str: "a"},
+		"b/c": Content{Ref: "a"},
+	}
+	dir, cleanup, err := RestoreTemp(assets, assets.Names()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range assets.Names() {
+		if data, _ := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name))); string(data) != "a" {
+			t.Errorf("%s should be restored yet got %s", name, data)
+		}
+	}
+	// the directories are searchable by the owner even if it is not root
+	if stat, err := os.Stat(filepath.Join(dir, "b")); err != nil || stat.Mode().Perm()&0700 != 0700 {
+		t.Errorf("b should be a directory accessible by the owner yet got %v %v", stat, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := cleanup(); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("%s should be removed", dir)
+	}
+
+	if _, _, err := RestoreTemp(assets, "a", "nothing"); err == nil {
+		t.Error("should fail to find nothing")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("<html><body>shipped</body></html>"))
+	zw.Close()
+	assets := &Assets{
+		"a.css": Content{Str: "body{}"},
+		"b.txt": Content{Chunks: []Content{{Str: "ab"}, {Bytes: []byte("cd")}}},
+		"page":  Content{Gziped: true, Bytes: buf.Bytes()},
+	}
+	server := httptest.NewServer(Handler(assets))
+	defer server.Close()
+	// the transport must not decompress the responses itself
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	get := func(name string, header ...string) (*http.Response, string) {
+		req, _ := http.NewRequest("GET", server.URL+"/"+name, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		return res, string(body)
+	}
+
+	res, body := get("a.css")
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/css") || body != "body{}" {
+		t.Errorf("a.css is served as %s: %s", res.Header.Get("Content-Type"), body)
+	}
+	if res, _ := get("a.css", "If-None-Match", res.Header.Get("ETag")); res.StatusCode != http.StatusNotModified {
+		t.Errorf("a.css should not be modified yet got %s", res.Status)
+	}
+	if res, body := get("a.css", "Range", "bytes=1-3"); res.StatusCode != http.StatusPartialContent || body != "ody" {
+		t.Errorf("a.css should be partially served yet got %s: %s", res.Status, body)
+	}
+
+	if res, body := get("b.txt", "Range", "bytes=1-2"); res.StatusCode != http.StatusPartialContent || body != "bc" {
+		t.Errorf("b.txt should be partially served yet got %s: %s", res.Status, body)
+	}
+
+	res, body = get("page")
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") || res.Header.Get("Content-Encoding") != "" ||
+		body != "<html><body>shipped</body></html>" {
+		t.Errorf("page is served as %s: %s", res.Header.Get("Content-Type"), body)
+	}
+	plain := res.Header.Get("ETag")
+	res, body = get("page", "Accept-Encoding", "gzip")
+	if res.Header.Get("Content-Encoding") != "gzip" || body != buf.String() {
+		t.Errorf("page should be served compressed yet got %q", res.Header.Get("Content-Encoding"))
+	}
+	if res.Header.Get("ETag") == plain {
+		t.Error("the compressed page should be tagged differently")
+	}
+	for _, header := range []string{"gzip;q=0", "*;q=0", "*, gzip;q=0", "identity"} {
+		if res, _ := get("page", "Accept-Encoding", header); res.Header.Get("Content-Encoding") != "" {
+			t.Errorf("page should not be served compressed for %s", header)
+		}
+	}
+	for _, header := range []string{"*;q=0, gzip", "*", "deflate, gzip;q=0.5"} {
+		if res, _ := get("page", "Accept-Encoding", header); res.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("page should be served compressed for %s", header)
+		}
+	}
+
+	if res, _ := get("nothing"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("nothing should not be found yet got %s", res.Status)
+	}
+}
+
+const developer = `package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func main() {
+	content, _ := A.Get("a.txt")
+	data, _ := content.Data()
+	fmt.Print(string(data), " ", strings.Join(A.Names(), ","))
+}`
+
+func TestDevelop(t *testing.T) {
+	src := t.TempDir()
+	ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("shipped"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "b.bin"), []byte("excluded"), 0644)
+	meta := Meta{Package: "main", VarName: "A", Dir: src, Dev: true}
+	meta.Including("*.txt", true)
+	exe := build(t, meta, developer)
+	defer os.RemoveAll(filepath.Dir(exe))
+
+	ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("edited"), 0644)
+	ioutil.WriteFile(filepath.Join(src, "c.txt"), []byte("added"), 0644)
+	for env, want := range map[string]string{"": "shipped a.txt", "1": "edited a.txt,c.txt"} {
+		cmd := exec.Command(exe)
+		cmd.Env = append(os.Environ(), DevEnv+"="+env)
+		if out, err := cmd.CombinedOutput(); err != nil || string(out) != want {
+			t.Errorf("should print %q with %s=%s yet got %q %v", want, DevEnv, env, out, err)
+		}
+	}
+
+	// the shipped go file could not be found without its full path
+	trimmed := build(t, meta, developer, "GOFLAGS=-trimpath")
+	defer os.RemoveAll(filepath.Dir(trimmed))
+	cmd := exec.Command(trimmed)
+	cmd.Env = append(os.Environ(), DevEnv+"=1")
+	if out, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(out), "-trimpath") {
+		t.Errorf("should fail to develop with -trimpath yet got %s", out)
+	}
+
+	setenv(t, DevEnv, "1")
+	assets := &Assets{}
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			assets.Names()
+		}
+	}()
+	if err := Develop(assets, src, "*.txt"); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if err := Develop(assets, filepath.Join(src, "nothing"), "*.txt"); err == nil {
+		t.Error("should fail to develop nothing")
+	}
+	for _, name := range []string{"b.bin", "../a.txt", "./a.txt"} {
+		if _, ok := assets.Get(name); ok {
+			t.Errorf("%s should not be read", name)
+		}
+	}
+	meta.Standalone = true
+	if _, err := NewBundle(meta).AddIncluded().WriteTo(ioutil.Discard); err == nil {
+		t.Error("should fail to develop standalone")
+	}
+}
+
+const registrant = `package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/sinloss/shipper/shipper"
+)
+
+func main() {
+	r, err := shipper.Open("web:a.txt")
+	if err != nil {
+		panic(err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	fmt.Print(string(data))
+}`
+
+func TestRegister(t *testing.T) {
+	src := t.TempDir()
+	ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("registered"), 0644)
+	meta := Meta{Package: "main", VarName: "A", Dir: src, Namespace: "web"}
+	meta.Including("*", true)
+	exe := build(t, meta, registrant)
+	defer os.RemoveAll(filepath.Dir(exe))
+	if out, err := exec.Command(exe).CombinedOutput(); err != nil || string(out) != "registered" {
+		t.Errorf("should open web:a.txt yet got %s %v", out, err)
+	}
+
+	assets := &Assets{"a": Content{Str: "a"}}
+	Register("test", assets)
+	defer unregister("test")
+	if c, ok := Lookup("test"); !ok || c != Cargo(assets) {
+		t.Error("test should be looked up")
+	}
+	if r, err := Open("test:a"); err != nil {
+		t.Error(err)
+	} else {
+		r.Close()
+	}
+	for _, name := range []string{"a", "nothing:a", "test:b"} {
+		if _, err := Open(name); err == nil {
+			t.Errorf("should fail to open %s", name)
+		}
+	}
+	for _, ns := range []string{"test", "", "a:b"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("should fail to register %q", ns)
+				}
+			}()
+			Register(ns, assets)
+		}()
+	}
+	unregister("test")
+	if _, ok := Lookup("test"); ok {
+		t.Error("test should be unregistered")
+	}
+	meta.Namespace = "a:b"
+	if _, err := NewBundle(meta).AddIncluded().WriteTo(ioutil.Discard); err == nil {
+		t.Error("should fail to ship under a:b")
+	}
+}
+
+func TestFormatted(t *testing.T) {
+	var out bytes.Buffer
+	g, err := formatting("a.go", nopCloser{&out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	io.WriteString(g, "package a\nvar  A = []string{\"")
+	contents(g).Write(data)
+	io.WriteString(g, "\", \"")
+	io.WriteString(g, "\",\n\"")
+	contents(g).Write(data[:1])
+	io.WriteString(g, "\"}\n")
+	// the contents are never held in memory
+	if g.skeleton.Len() > 1024 {
+		t.Errorf("the skeleton should not carry the contents yet got %d bytes", g.skeleton.Len())
+	}
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	(&w{&want}).Write(data)
+	if !strings.HasPrefix(out.String(), "package a\n\nvar A = []string{\""+want.String()+"\", \"\",\n") {
+		t.Errorf("the contents should be spliced into the formatted go file")
+	}
+	if g.spool != nil {
+		if _, err := os.Stat(g.spool.Name()); !os.IsNotExist(err) {
+			t.Error("the spool should be removed")
+		}
+	}
+
+	g, _ = formatting("b.go", nopCloser{ioutil.Discard})
+	io.WriteString(g, "package b\nvar B = \"")
+	contents(g).Write(data[:10])
+	if err := g.Close(); err == nil {
+		t.Error("should fail to parse")
+	}
+}
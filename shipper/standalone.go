@@ -0,0 +1,208 @@
+package shipper
+
+import (
+	"text/template"
+)
+
+// Standalone moulds the private copies of the shipper types shipped along with
+// the contents in the standalone mode, which are named after the variable
+var standalone = template.Must(shipped.New("standalone").Parse(`{{$p := low .VarName}}
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// {{$p}}Content represents a file's content
+type {{$p}}Content struct {
+	Gziped bool
+	Bytes  []byte
+	Str    string
+	Chunks []{{$p}}Content
+	Ref    string
+}
+
+// raw returns a reader of the content as it is shipped
+func (c {{$p}}Content) raw() io.Reader {
+	if c.Chunks != nil {
+		readers := make([]io.Reader, len(c.Chunks))
+		for i, chunk := range c.Chunks {
+			readers[i] = chunk.raw()
+		}
+		return io.MultiReader(readers...)
+	}
+	if c.Bytes != nil {
+		return bytes.NewReader(c.Bytes)
+	}
+	return strings.NewReader(c.Str)
+}
+
+// Reader returns a reader of the uncompressed content
+func (c {{$p}}Content) Reader() (io.ReadCloser, error) {
+	if c.Gziped {
+		return gzip.NewReader(c.raw())
+	}
+	return ioutil.NopCloser(c.raw()), nil
+}
+
+// Data reads all the uncompressed content
+func (c {{$p}}Content) Data() ([]byte, error) {
+	if !c.Gziped && c.Bytes != nil {
+		return c.Bytes, nil
+	}
+	r, err := c.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// chunked puts the given chunk as the i-th chunk of the content
+func (c {{$p}}Content) chunked(i int, chunk {{$p}}Content) {{$p}}Content {
+	for len(c.Chunks) <= i {
+		c.Chunks = append(c.Chunks, {{$p}}Content{})
+	}
+	c.Chunks[i] = chunk
+	c.Gziped = chunk.Gziped
+	return c
+}
+
+// restore restores the uncompressed content to the given dest path
+func (c {{$p}}Content) restore(dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	r, err := c.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+{{if .Table}}
+// {{$p}}Entry pairs a file's name with its content
+type {{$p}}Entry struct {
+	Name    string
+	Content {{$p}}Content
+}
+
+// {{$p}}Table is a slice of entries sorted by name, which is looked up by
+// binary search
+type {{$p}}Table []{{$p}}Entry
+
+// search finds the index where the entry with the given name is or should be
+func (t *{{$p}}Table) search(name string) (int, bool) {
+	entries := *t
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].Name >= name
+	})
+	return i, i < len(entries) && entries[i].Name == name
+}
+
+// Get returns the content of the entry with the given name
+func (t *{{$p}}Table) Get(name string) ({{$p}}Content, bool) {
+	i, ok := t.search(name)
+	if ok && (*t)[i].Content.Ref != "" {
+		i, ok = t.search((*t)[i].Content.Ref)
+	}
+	if ok {
+		return (*t)[i].Content, true
+	}
+	return {{$p}}Content{}, false
+}
+
+// Put puts the entry of the given name and content in order
+func (t *{{$p}}Table) Put(name string, content {{$p}}Content) {
+	i, ok := t.search(name)
+	if !ok {
+		*t = append(*t, {{$p}}Entry{})
+		copy((*t)[i+1:], (*t)[i:])
+	}
+	(*t)[i] = {{$p}}Entry{Name: name, Content: content}
+}
+
+// PutChunk puts the i-th chunk of the content of the entry with the given name
+func (t *{{$p}}Table) PutChunk(name string, i int, chunk {{$p}}Content) {
+	var content {{$p}}Content
+	if j, ok := t.search(name); ok {
+		content = (*t)[j].Content
+	}
+	t.Put(name, content.chunked(i, chunk))
+}
+
+// Names returns the sorted names of all the entries
+func (t *{{$p}}Table) Names() []string {
+	names := make([]string, len(*t))
+	for i, e := range *t {
+		names[i] = e.Name
+	}
+	return names
+}
+{{else}}
+// {{$p}}Assets maps a file's name to its content
+type {{$p}}Assets map[string]{{$p}}Content
+
+// Get returns the content mapped to the given name
+func (as *{{$p}}Assets) Get(name string) ({{$p}}Content, bool) {
+	content, ok := (*as)[name]
+	if ok && content.Ref != "" {
+		content, ok = (*as)[content.Ref]
+	}
+	return content, ok
+}
+
+// Names returns the sorted names of all the contents
+func (as *{{$p}}Assets) Names() []string {
+	names := make([]string, 0, len(*as))
+	for name := range *as {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Put maps the given name to the content
+func (as *{{$p}}Assets) Put(name string, content {{$p}}Content) {
+	(*as)[name] = content
+}
+
+// PutChunk puts the i-th chunk of the content mapped to the given name
+func (as *{{$p}}Assets) PutChunk(name string, i int, chunk {{$p}}Content) {
+	(*as)[name] = (*as)[name].chunked(i, chunk)
+}
+{{end}}
+// Restore restores the underlying contents to the current working directory
+// with their original names
+func (x *{{template "cargo" .}}) Restore(names ...string) error {
+	for _, name := range names {
+		if err := x.RestoreAs(name, filepath.FromSlash(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreAs restores the underlying contents to the given dest path
+func (x *{{template "cargo" .}}) RestoreAs(name string, dest string) error {
+	content, ok := x.Get(name)
+	if !ok {
+		return errors.New("could not find contents mapped to the given filename " + name)
+	}
+	return content.restore(dest)
+}
+`))
@@ -0,0 +1,83 @@
+package shipper
+
+import (
+	"sort"
+)
+
+// Entry pairs a file's name with its content
+type Entry struct {
+	Name string
+	Content
+}
+
+// Table is a slice of entries sorted by name, which is looked up by binary
+// search. Unlike Assets it is laid out statically so that no map needs to be
+// built at init
+type Table []Entry
+
+// search finds the index where the entry with the given name is or should be
+func (t *Table) search(name string) (int, bool) {
+	entries := *t
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].Name >= name
+	})
+	return i, i < len(entries) && entries[i].Name == name
+}
+
+// Get returns the content of the entry with the given name
+func (t *Table) Get(name string) (Content, bool) {
+	if d := developing(t); d != nil {
+		return d.Get(name)
+	}
+	i, ok := t.search(name)
+	if ok && (*t)[i].Ref != "" {
+		i, ok = t.search((*t)[i].Ref)
+	}
+	if ok {
+		return (*t)[i].Content, true
+	}
+	return Content{}, false
+}
+
+// Put puts the entry of the given name and content in order, which is used by
+// the sharded shipped files to register their contents at init
+func (t *Table) Put(name string, content Content) {
+	i, ok := t.search(name)
+	if !ok {
+		*t = append(*t, Entry{})
+		copy((*t)[i+1:], (*t)[i:])
+	}
+	(*t)[i] = Entry{Name: name, Content: content}
+}
+
+// PutChunk puts the i-th chunk of the content of the entry with the given name
+func (t *Table) PutChunk(name string, i int, chunk Content) {
+	var content Content
+	if j, ok := t.search(name); ok {
+		content = (*t)[j].Content
+	}
+	t.Put(name, content.chunked(i, chunk))
+}
+
+// Names returns the sorted names of all the entries
+func (t *Table) Names() []string {
+	if d := developing(t); d != nil {
+		return d.Names()
+	}
+	names := make([]string, len(*t))
+	for i, e := range *t {
+		names[i] = e.Name
+	}
+	return names
+}
+
+// Restore restores the underlying contents to the current working directory
+// with its original name
+func (t *Table) Restore(names ...string) error {
+	return restore(t, names...)
+}
+
+// RestoreAs restores the underlying contents to the given dest path
+func (t *Table) RestoreAs(name string, dest string) error {
+	return restoreAs(t, name, dest)
+}
@@ -3,21 +3,32 @@ package shipper
 import (
 	"bytes"
 	"compress/gzip"
+	"io"
 	"io/ioutil"
-	"os"
 
 	"github.com/sinloss/shipper/util"
 )
 
 type w struct {
-	f *os.File
+	f io.Writer
+}
+
+// gzipper makes a gzip writer whose header depends on neither the time, the
+// os nor the file, so that the shipped contents are reproducible
+func gzipper(w io.Writer) *gzip.Writer {
+	zw := gzip.NewWriter(w)
+	zw.Header = gzip.Header{OS: 255} // unknown os
+	return zw
 }
 
 // Gzip compresses the given bytes
 func Gzip(wo *w, p []byte) (n int, err error) {
-	zw := gzip.NewWriter(wo)
-	defer zw.Close()
-	return zw.Write(p)
+	zw := gzipper(wo)
+	if n, err = zw.Write(p); err != nil {
+		zw.Close()
+		return n, err
+	}
+	return n, zw.Close()
 }
 
 func (wo *w) Write(p []byte) (n int, err error) {
@@ -28,7 +39,9 @@ func (wo *w) Write(p []byte) (n int, err error) {
 		hex[j+2], hex[j+3] = util.Hexchar(b)
 		j += 4
 	}
-	return wo.f.Write(hex)
+	// every byte is written as 4 hex chars
+	n, err = wo.f.Write(hex)
+	return n / 4, err
 }
 
 // UnGzip uncompresses the given gz format bytes